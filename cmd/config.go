@@ -82,6 +82,17 @@ var showConfigCmd = &cobra.Command{
 			}
 		}
 
+		if cfg.Org.Active() {
+			fmt.Printf("\nLocked by %s:\n", cfg.Org.Path)
+			locked := cfg.Org.LockedSettings()
+			if len(locked) == 0 {
+				fmt.Println("  nothing")
+			}
+			for _, setting := range locked {
+				fmt.Printf("  %s\n", setting)
+			}
+		}
+
 		return nil
 	},
 }
@@ -0,0 +1,50 @@
+package cmd
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/samanar/clai/model"
+	"github.com/spf13/cobra"
+)
+
+// indexCmd represents the index command
+var indexCmd = &cobra.Command{
+	Use:   "index",
+	Short: "Manage the man page search index",
+	Long: `Manage the local search index built from the NAME, SYNOPSIS and DESCRIPTION
+of every section 1 and 8 man page (and tldr pages when enabled).
+
+The index is updated automatically when the contents of MANPATH change.`,
+}
+
+// rebuildIndexCmd represents the index rebuild command
+var rebuildIndexCmd = &cobra.Command{
+	Use:   "rebuild",
+	Short: "Rebuild the man page search index from scratch",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := model.NewConfig()
+		if err != nil {
+			return fmt.Errorf("failed to load config: %w", err)
+		}
+
+		start := time.Now()
+		index, err := model.RebuildManIndex(cmd.Context(), cfg.Index)
+		if err != nil {
+			return fmt.Errorf("failed to rebuild index: %w", err)
+		}
+		indexPath, err := model.ManIndexPath()
+		if err != nil {
+			return fmt.Errorf("failed to get index path: %w", err)
+		}
+
+		fmt.Printf("✓ Indexed %d pages in %s\n", index.Len(), time.Since(start).Round(time.Millisecond))
+		fmt.Printf("Index file: %s\n", indexPath)
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(indexCmd)
+	indexCmd.AddCommand(rebuildIndexCmd)
+}
@@ -0,0 +1,191 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/mattn/go-isatty"
+	"github.com/samanar/clai/components"
+	"github.com/samanar/clai/model"
+	"github.com/spf13/cobra"
+)
+
+// planCmd represents the plan command
+var planCmd = &cobra.Command{
+	Use:   "plan [task]",
+	Short: "Break a task into steps and work through them one by one",
+	Long: `Ask the model for the ordered steps of a task, such as "create a venv,
+install the requirements and run the tests", and work through them in a
+checklist: run, skip or edit each step in turn. Running stops at the
+first step that fails.
+
+Examples:
+  clai plan set up a python venv and run the tests
+  clai plan --export setup.sh set up a python venv and run the tests`,
+	Args:         cobra.MinimumNArgs(1),
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		task := strings.Join(args, " ")
+		m, err := model.NewModel()
+		if err != nil {
+			return fmt.Errorf("failed to initialize model: %w", err)
+		}
+		if err := m.EnsureAssets(); err != nil {
+			return fmt.Errorf("failed to ensure assets: %w", err)
+		}
+
+		plan, err := m.Plan(task)
+		if err != nil {
+			return fmt.Errorf("failed to plan the task: %w", err)
+		}
+		cmd.Println("\nPlan:")
+		cmd.Println(strings.Repeat("─", 60))
+		for i, step := range plan.Steps {
+			cmd.Printf("\n%s", renderStep(i+1, step))
+		}
+		cmd.Println()
+
+		if path, _ := cmd.Flags().GetString("export"); path != "" {
+			if err := model.WriteScript(path, plan.Script()); err != nil {
+				return fmt.Errorf("failed to export the plan: %w", err)
+			}
+			fmt.Printf("Exported to %s\n", path)
+			return nil
+		}
+		noInteractive, _ := cmd.Flags().GetBool("no-interactive")
+		if noInteractive || !isatty.IsTerminal(os.Stdin.Fd()) || !isatty.IsTerminal(os.Stdout.Fd()) {
+			return nil
+		}
+		return runPlan(&m, plan)
+	},
+}
+
+// runPlan works through the steps of plan in a checklist. Each step is
+// run like a chosen suggestion, through the safety policy, undo backups
+// and the audit log; running stops at the first that fails.
+func runPlan(m *model.Model, plan *model.Plan) error {
+	statuses := make([]components.ChecklistStatus, len(plan.Steps))
+	actions := []components.ChecklistAction{
+		{Key: "r", Label: "run", Value: "run"},
+		{Key: "s", Label: "skip", Value: "skip"},
+		{Key: "e", Label: "edit", Value: "edit"},
+		{Key: "x", Label: "export", Value: "export"},
+	}
+	if m.Config.Org.DisableExecution {
+		actions = actions[1:]
+	}
+
+	// Values given for a placeholder are offered again for the next step
+	// that uses it.
+	values := make(map[string]string)
+	message := ""
+	for current := 0; current < len(plan.Steps); {
+		action, err := components.Checklist(checklistItems(plan, statuses), current, actions, message)
+		if err != nil {
+			return err
+		}
+		message = ""
+		step := plan.Steps[current]
+
+		switch action {
+		case "":
+			return nil
+		case "run":
+			filled, ok, err := fillPlaceholders(m, step.Result, values)
+			if err != nil {
+				return err
+			}
+			if !ok {
+				message = "Step not run."
+				continue
+			}
+			plan.Steps[current].Result = filled
+			step = plan.Steps[current]
+			fmt.Println(hintStyle.Render(fmt.Sprintf("==> %d. %s", current+1, step.Title)))
+			// The audit log shows the task the step belongs to. A step
+			// is no example for a query of its own, so the history is
+			// left alone.
+			exitCode, ran, err := runChecked(m, plan.Task, step.Result, nil)
+			switch {
+			case err != nil:
+				message = err.Error()
+			case !ran:
+				message = "Step not run."
+			case exitCode != 0:
+				statuses[current] = components.ChecklistFailed
+				fmt.Fprintf(os.Stderr, "Step %d failed with exit code %d; the steps after it were not run.\n", current+1, exitCode)
+				os.Exit(exitCode)
+			default:
+				statuses[current] = components.ChecklistDone
+				current++
+			}
+		case "skip":
+			statuses[current] = components.ChecklistSkipped
+			current++
+		case "edit":
+			line, ok, err := components.Input(fmt.Sprintf("Step %d:", current+1), step.CommandLine())
+			if err != nil {
+				return err
+			}
+			if ok {
+				if err := m.EditStep(plan, current, line); err != nil {
+					message = fmt.Sprintf("Step not changed: %v", err)
+				}
+			}
+		case "export":
+			path, ok, err := components.Input("Export to:", "plan.sh")
+			if err != nil {
+				return err
+			}
+			if ok && path != "" {
+				message = "Exported to " + path
+				if err := model.WriteScript(path, plan.Script()); err != nil {
+					message = fmt.Sprintf("Failed to export the plan: %v", err)
+				}
+			}
+		}
+	}
+
+	done := 0
+	for _, status := range statuses {
+		if status == components.ChecklistDone {
+			done++
+		}
+	}
+	fmt.Printf("Plan finished: %d of %d step(s) run.\n", done, len(plan.Steps))
+	return nil
+}
+
+// checklistItems lists the steps of plan with their status, noting for
+// each what it needs, what it should achieve and why the safety policy
+// objects to it.
+func checklistItems(plan *model.Plan, statuses []components.ChecklistStatus) []components.ChecklistItem {
+	items := make([]components.ChecklistItem, len(plan.Steps))
+	for i, step := range plan.Steps {
+		item := components.ChecklistItem{
+			Title:  step.Title,
+			Detail: "$ " + step.CommandLine(),
+			Status: statuses[i],
+		}
+		for _, n := range step.DependsOn {
+			if statuses[n-1] == components.ChecklistSkipped {
+				item.Notes = append(item.Notes, fmt.Sprintf("Needs step %d, which was skipped", n))
+			}
+		}
+		if step.Expect != "" {
+			item.Notes = append(item.Notes, "Expect: "+step.Expect)
+		}
+		for _, reason := range step.Decision.Reasons {
+			item.Notes = append(item.Notes, "✗ "+reason)
+		}
+		items[i] = item
+	}
+	return items
+}
+
+func init() {
+	rootCmd.AddCommand(planCmd)
+	planCmd.Flags().StringP("export", "o", "", "Write the plan to this file as a shell script instead of running it")
+	planCmd.Flags().Bool("no-interactive", false, "Only print the plan, do not work through it")
+}
@@ -0,0 +1,193 @@
+package cmd
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/charmbracelet/lipgloss"
+	"github.com/samanar/clai/model"
+)
+
+var (
+	commandStyle     = lipgloss.NewStyle().Bold(true)
+	operatorStyle    = lipgloss.NewStyle().Foreground(lipgloss.Color("75"))
+	placeholderStyle = lipgloss.NewStyle().Foreground(lipgloss.Color("214")).Underline(true)
+	explainStyle     = lipgloss.NewStyle().Foreground(lipgloss.Color("252"))
+	hintStyle        = lipgloss.NewStyle().Foreground(lipgloss.Color("240"))
+	rootStyle        = lipgloss.NewStyle().Bold(true).Foreground(lipgloss.Color("201"))
+	warningStyle     = lipgloss.NewStyle().Foreground(lipgloss.Color("208"))
+	blockedStyle     = lipgloss.NewStyle().Bold(true).Foreground(lipgloss.Color("196"))
+	createdStyle     = lipgloss.NewStyle().Foreground(lipgloss.Color("42"))
+	modifiedStyle    = lipgloss.NewStyle().Foreground(lipgloss.Color("220"))
+	deletedStyle     = lipgloss.NewStyle().Foreground(lipgloss.Color("196"))
+
+	riskStyles = map[model.Risk]lipgloss.Style{
+		model.RiskReadOnly:      lipgloss.NewStyle().Foreground(lipgloss.Color("42")),
+		model.RiskModifiesFiles: lipgloss.NewStyle().Foreground(lipgloss.Color("220")),
+		model.RiskDestructive:   lipgloss.NewStyle().Bold(true).Foreground(lipgloss.Color("196")),
+		model.RiskNetwork:       lipgloss.NewStyle().Foreground(lipgloss.Color("39")),
+	}
+)
+
+// renderResult formats one suggestion for the terminal: the explanation
+// with risk and root badges, the command line with operators and
+// placeholders highlighted, what each placeholder stands for, the
+// problems validation found and why the safety policy objects to it.
+func renderResult(index int, result model.Result) string {
+	var builder strings.Builder
+
+	header := fmt.Sprintf("%d. %s", index, explainStyle.Render(result.Explain))
+	var badges []string
+	if result.Risk != "" {
+		style, ok := riskStyles[result.Risk]
+		if !ok {
+			style = hintStyle
+		}
+		badges = append(badges, style.Render("["+string(result.Risk)+"]"))
+	}
+	if result.RequiresRoot {
+		badges = append(badges, rootStyle.Render("[root]"))
+	}
+	switch {
+	case result.Decision.Blocked():
+		badges = append(badges, blockedStyle.Render("[blocked]"))
+	case result.Decision.NeedsConfirmation():
+		badges = append(badges, warningStyle.Render("[confirm]"))
+	}
+	if len(badges) > 0 {
+		header += " " + strings.Join(badges, " ")
+	}
+	builder.WriteString(header)
+	builder.WriteString("\n   $ ")
+	builder.WriteString(renderCommandLine(result))
+	builder.WriteString("\n")
+
+	descriptions := make(map[string]model.Placeholder)
+	for _, placeholder := range result.Placeholders {
+		descriptions[placeholder.Name] = placeholder
+	}
+	for _, name := range result.PlaceholderNames() {
+		line := "     " + placeholderStyle.Render("<"+name+">")
+		if placeholder, ok := descriptions[name]; ok && placeholder.Description != "" {
+			line += hintStyle.Render(" " + placeholder.Description)
+		}
+		if placeholder, ok := descriptions[name]; ok && placeholder.Default != "" {
+			line += hintStyle.Render(fmt.Sprintf(" (default %s)", placeholder.Default))
+		}
+		builder.WriteString(line)
+		builder.WriteString("\n")
+	}
+	for _, warning := range result.Warnings {
+		builder.WriteString("   " + warningStyle.Render("! "+warning))
+		builder.WriteString("\n")
+	}
+	policyStyle := warningStyle
+	if result.Decision.Blocked() {
+		policyStyle = blockedStyle
+	}
+	for _, reason := range result.Decision.Reasons {
+		builder.WriteString("   " + policyStyle.Render("✗ "+reason))
+		builder.WriteString("\n")
+	}
+	return builder.String()
+}
+
+// renderStep formats one step of a plan like a suggestion, titled, with
+// what it does, the steps it needs and what it should achieve below.
+func renderStep(index int, step model.Step) string {
+	result := step.Result
+	result.Explain = step.Title
+	var builder strings.Builder
+	builder.WriteString(renderResult(index, result))
+	if step.Explain != "" {
+		builder.WriteString("   " + explainStyle.Render(step.Explain) + "\n")
+	}
+	var notes []string
+	if len(step.DependsOn) > 0 {
+		needs := make([]string, len(step.DependsOn))
+		for i, n := range step.DependsOn {
+			needs[i] = strconv.Itoa(n)
+		}
+		notes = append(notes, "needs step "+strings.Join(needs, ", "))
+	}
+	if step.Expect != "" {
+		notes = append(notes, "expect: "+step.Expect)
+	}
+	if len(notes) > 0 {
+		builder.WriteString("   " + hintStyle.Render(strings.Join(notes, " · ")) + "\n")
+	}
+	return builder.String()
+}
+
+// renderCommandLine styles the quoted command line for the user's shell.
+// A line the user typed is shown as typed.
+func renderCommandLine(result model.Result) string {
+	if result.Line != "" {
+		return highlightPlaceholders(result.Line)
+	}
+	var parts []string
+	for _, token := range result.Tokens(model.DialectForShell(model.UserShell())) {
+		switch token.Kind {
+		case model.TokenCommand:
+			parts = append(parts, commandStyle.Render(highlightPlaceholders(token.Text)))
+		case model.TokenOperator:
+			parts = append(parts, operatorStyle.Render(token.Text))
+		default:
+			parts = append(parts, highlightPlaceholders(token.Text))
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+func highlightPlaceholders(text string) string {
+	return model.ReplacePlaceholders(text, func(name string) string {
+		return placeholderStyle.Render("<" + name + ">")
+	})
+}
+
+// renderPreview formats what a dry run did: the files it created,
+// modified and deleted, diffs of the modified ones, and its output.
+func renderPreview(report *model.PreviewReport) string {
+	var builder strings.Builder
+	if !report.Changed() {
+		builder.WriteString(hintStyle.Render("No files would change.") + "\n")
+	}
+	for _, path := range report.Created {
+		builder.WriteString(createdStyle.Render("+ "+path) + "\n")
+	}
+	for _, path := range report.Modified {
+		builder.WriteString(modifiedStyle.Render("~ "+path) + "\n")
+	}
+	for _, path := range report.Deleted {
+		builder.WriteString(deletedStyle.Render("- "+path) + "\n")
+	}
+	for _, path := range report.Modified {
+		diff, ok := report.Diffs[path]
+		if !ok {
+			continue
+		}
+		builder.WriteString("\n")
+		for _, line := range strings.Split(strings.TrimRight(diff, "\n"), "\n") {
+			switch {
+			case strings.HasPrefix(line, "+++"), strings.HasPrefix(line, "---"):
+				line = commandStyle.Render(line)
+			case strings.HasPrefix(line, "+"):
+				line = createdStyle.Render(line)
+			case strings.HasPrefix(line, "-"):
+				line = deletedStyle.Render(line)
+			case strings.HasPrefix(line, "@@"):
+				line = operatorStyle.Render(line)
+			}
+			builder.WriteString(line + "\n")
+		}
+	}
+	if report.Stdout != "" {
+		builder.WriteString("\n" + hintStyle.Render("stdout:") + "\n" + strings.TrimRight(report.Stdout, "\n") + "\n")
+	}
+	if report.Stderr != "" {
+		builder.WriteString("\n" + hintStyle.Render("stderr:") + "\n" + strings.TrimRight(report.Stderr, "\n") + "\n")
+	}
+	builder.WriteString("\n" + hintStyle.Render(fmt.Sprintf("exit code %d", report.ExitCode)) + "\n")
+	return builder.String()
+}
@@ -4,10 +4,18 @@ Copyright © 2025 NAME HERE <EMAIL ADDRESS>
 package cmd
 
 import (
+	"bufio"
+	"context"
+	"errors"
 	"fmt"
+	"io"
 	"os"
+	"path/filepath"
+	"strconv"
 	"strings"
 
+	"github.com/mattn/go-isatty"
+	"github.com/samanar/clai/components"
 	"github.com/samanar/clai/model"
 	"github.com/spf13/cobra"
 )
@@ -34,7 +42,22 @@ Special commands:
 	DisableSuggestions:         true,
 	SilenceErrors:              true,
 	Run: func(cmd *cobra.Command, args []string) {
+		showContext, _ := cmd.Flags().GetBool("show-context")
+		withWorkspace, _ := cmd.Flags().GetBool("workspace")
+
 		// Join all arguments into a single string as user input
+		if len(args) == 0 && showContext {
+			m, err := model.NewModel()
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error initializing model: %v\n", err)
+				os.Exit(1)
+			}
+			if withWorkspace {
+				m.Config.Workspace.Enabled = true
+			}
+			fmt.Println(m.Context(""))
+			return
+		}
 		if len(args) == 0 {
 			cmd.Println("Error: Please provide a query")
 			cmd.Println("Usage: clai \"your query here\"")
@@ -50,12 +73,31 @@ Special commands:
 			os.Exit(1)
 		}
 
+		if withWorkspace {
+			m.Config.Workspace.Enabled = true
+		}
+
+		if showContext {
+			cmd.Println("Context:")
+			cmd.Println(m.Context(userInput))
+			cmd.Println()
+		}
+
 		if err := m.EnsureAssets(); err != nil {
 			fmt.Fprintf(os.Stderr, "Error ensuring assets: %v\n", err)
 			os.Exit(1)
 		}
 
 		results, err := m.Ask(userInput)
+		var generationErr *model.GenerationError
+		if errors.As(err, &generationErr) {
+			fmt.Fprintf(os.Stderr, "Error processing query: %v\n", generationErr)
+			fmt.Fprintln(os.Stderr, "Try rephrasing the query, or a larger model with: clai config set-model")
+			if generationErr.Raw != "" {
+				fmt.Fprintf(os.Stderr, "Last model output: %s\n", generationErr.Raw)
+			}
+			os.Exit(1)
+		}
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "Error processing query: %v\n", err)
 			os.Exit(1)
@@ -71,19 +113,363 @@ Special commands:
 		cmd.Println(strings.Repeat("─", 60))
 
 		for i, result := range results {
-			cmd.Printf("\n%d. %s\n", i+1, result.Explain)
+			cmd.Printf("\n%s", renderResult(i+1, result))
+		}
+
+		cmd.Println()
 
-			// Build full command string
-			fullCmd := result.Cmd
-			if len(result.Args) > 0 {
-				fullCmd += " " + strings.Join(result.Args, " ")
+		noInteractive, _ := cmd.Flags().GetBool("no-interactive")
+		if noInteractive || !isatty.IsTerminal(os.Stdin.Fd()) || !isatty.IsTerminal(os.Stdout.Fd()) {
+			return
+		}
+		preview, _ := cmd.Flags().GetBool("preview")
+		agent, _ := cmd.Flags().GetBool("agent")
+		if err := chooseResult(cmd, &m, userInput, results, preview, agent); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+	},
+}
+
+// chooseResult lets the user pick one of the suggestions and records the
+// choice as feedback, which later queries use as few-shot examples.
+// Secrets from the query are masked in what is recorded.
+func chooseResult(cmd *cobra.Command, m *model.Model, userInput string, results []model.Result, preview, agent bool) error {
+	cfg := m.Config
+	recordFeedback := func(kind model.FeedbackKind, result model.Result) error {
+		return model.RecordFeedback(m.Secrets.Mask(userInput), kind, m.Secrets.MaskResult(result))
+	}
+	options := []components.SelectOption{}
+	for i, result := range results {
+		if result.Decision.Blocked() {
+			continue
+		}
+		options = append(options, components.SelectOption{
+			Title:       result.CommandLine(),
+			Description: result.Explain,
+			Value:       strconv.Itoa(i),
+		})
+	}
+	options = append(options, components.SelectOption{
+		Title:       "None of these",
+		Description: "Mark the suggestions as wrong",
+		Value:       "none",
+	})
+
+	selected, err := components.Select(options)
+	if err != nil {
+		return err
+	}
+	if selected == "" {
+		return nil
+	}
+	if selected == "none" {
+		for _, result := range results {
+			if err := recordFeedback(model.FeedbackRejected, result); err != nil {
+				return fmt.Errorf("failed to record feedback: %w", err)
 			}
+		}
+		return nil
+	}
 
-			cmd.Printf("   $ %s\n", fullCmd)
+	index, err := strconv.Atoi(selected)
+	if err != nil {
+		return err
+	}
+	result, ok, err := fillPlaceholders(m, results[index], nil)
+	if err != nil || !ok {
+		return err
+	}
+
+	actions := []components.SelectOption{
+		{Title: "Run", Description: result.CommandLine(), Value: "run"},
+		{Title: "Preview", Description: "Run it in a throwaway copy of this directory and show what changes", Value: "preview"},
+		{Title: "Print", Description: "Print the command without running it", Value: "print"},
+	}
+	if cfg.Org.DisableExecution {
+		actions = actions[2:]
+	}
+	action := "preview"
+	if !preview || cfg.Org.DisableExecution {
+		action, err = components.Select(actions)
+		if err != nil {
+			return err
 		}
+	}
+	for action == "preview" {
+		if err := previewResult(cfg, result); err != nil {
+			fmt.Fprintf(os.Stderr, "Preview failed: %v\n", err)
+		}
+		// Previewing again would show the same, so it is not offered.
+		action, err = components.Select([]components.SelectOption{actions[0], actions[2]})
+		if err != nil {
+			return err
+		}
+	}
 
-		cmd.Println()
-	},
+	switch action {
+	case "run":
+		run := runResult
+		if agent || cfg.Agent.Enabled {
+			run = runAgent
+		}
+		exitCode, err := run(m, userInput, result)
+		if err != nil {
+			return err
+		}
+		if exitCode != 0 {
+			os.Exit(exitCode)
+		}
+	case "print":
+		if err := recordFeedback(model.FeedbackAccepted, result); err != nil {
+			return fmt.Errorf("failed to record feedback: %w", err)
+		}
+		fmt.Println(result.CommandLine())
+	}
+	return nil
+}
+
+// runResult runs result once it passes the safety policy, backing up
+// the paths it changes and recording it in the audit log and, once it
+// succeeds, in the history.
+func runResult(m *model.Model, userInput string, result model.Result) (int, error) {
+	exitCode, ran, err := runChecked(m, userInput, result, nil)
+	if err == nil && ran && exitCode == 0 {
+		err = recordRun(m, userInput, result)
+	}
+	return exitCode, err
+}
+
+// recordRun records result, which ran and worked, in the history. Only a
+// command that worked makes a good example for later queries.
+func recordRun(m *model.Model, userInput string, result model.Result) error {
+	if err := model.RecordFeedback(m.Secrets.Mask(userInput), model.FeedbackRun, m.Secrets.MaskResult(result)); err != nil {
+		return fmt.Errorf("failed to record feedback: %w", err)
+	}
+	return nil
+}
+
+// runChecked is runResult that copies the command's standard error to
+// stderr, if not nil, reports whether the command ran at all and leaves
+// the history alone.
+func runChecked(m *model.Model, userInput string, result model.Result, stderr io.Writer) (int, bool, error) {
+	cfg := m.Config
+	allowed, err := confirmRun(cfg, result)
+	if err != nil || !allowed {
+		return 0, false, err
+	}
+	if !cfg.Undo.Disabled {
+		snapshot, err := model.TakeSnapshot(cfg.Undo, result, m.Secrets)
+		switch {
+		case err != nil:
+			fmt.Fprintf(os.Stderr, "Warning: no backup taken, %v\n", err)
+		case snapshot != nil:
+			if len(snapshot.Entries) > 0 {
+				fmt.Println(hintStyle.Render(fmt.Sprintf("Backed up %d path(s); restore them with: clai undo", len(snapshot.Entries))))
+			}
+			if len(snapshot.Skipped) > 0 {
+				fmt.Fprintf(os.Stderr, "Warning: not backed up, clai undo could not restore them without root: %s\n", strings.Join(snapshot.Skipped, ", "))
+			}
+		}
+	}
+	audit, err := model.OpenAuditLog(cfg)
+	if err != nil {
+		if cfg.Org.RequireAudit {
+			return 0, false, fmt.Errorf("not running the command, the audit log required by %s is unavailable: %w", cfg.Org.Path, err)
+		}
+		fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+	}
+	exitCode, err := audit.Run(userInput, cfg.Model, result, m.Secrets, stderr)
+	return exitCode, err == nil, err
+}
+
+// runAgent runs result and, while it fails, sends the exit code and error
+// output back to the model and offers the fixes it suggests, up to the
+// configured number of attempts. Every fix goes through the same checks
+// as the first command.
+func runAgent(m *model.Model, userInput string, result model.Result) (int, error) {
+	attempts := m.Config.Agent.Attempts()
+	var failures []model.Failure
+	lastExitCode := 0
+	for attempt := 1; ; attempt++ {
+		output := model.NewFailureOutput()
+		exitCode, ran, err := runChecked(m, userInput, result, output)
+		if err != nil {
+			return exitCode, err
+		}
+		if !ran {
+			return lastExitCode, nil
+		}
+		if exitCode == 0 {
+			return 0, recordRun(m, userInput, result)
+		}
+		lastExitCode = exitCode
+		if attempt > attempts {
+			fmt.Fprintf(os.Stderr, "Still failing after %d fix(es), giving up.\n", attempts)
+			return exitCode, nil
+		}
+
+		failures = append(failures, model.Failure{Command: result.CommandLine(), ExitCode: exitCode, Stderr: output.String()})
+		fmt.Println(hintStyle.Render(fmt.Sprintf("\nExited with code %d; asking for a fix (%d/%d) ...", exitCode, attempt, attempts)))
+		fixes, err := m.Fix(userInput, failures)
+		if err != nil {
+			return exitCode, fmt.Errorf("failed to get a fix: %w", err)
+		}
+		if len(fixes) == 0 {
+			fmt.Println("No other command was suggested.")
+			return exitCode, nil
+		}
+
+		options := []components.SelectOption{}
+		for i, fix := range fixes {
+			fmt.Printf("\n%s", renderResult(i+1, fix))
+			if fix.Decision.Blocked() {
+				continue
+			}
+			options = append(options, components.SelectOption{
+				Title:       fix.CommandLine(),
+				Description: fix.Explain,
+				Value:       strconv.Itoa(i),
+			})
+		}
+		fmt.Println()
+		options = append(options, components.SelectOption{
+			Title:       "Stop",
+			Description: "Do not run any of these",
+			Value:       "stop",
+		})
+		selected, err := components.Select(options)
+		if err != nil {
+			return exitCode, err
+		}
+		if selected == "" || selected == "stop" {
+			return exitCode, nil
+		}
+		index, err := strconv.Atoi(selected)
+		if err != nil {
+			return exitCode, err
+		}
+		filled, ok, err := fillPlaceholders(m, fixes[index], nil)
+		if err != nil {
+			return exitCode, err
+		}
+		if !ok {
+			return exitCode, nil
+		}
+		result = filled
+	}
+}
+
+// fillPlaceholders asks for the value of each placeholder of result in a
+// form and returns the command with the values filled in, judged by the
+// safety policy again. Values in known, given for earlier commands, are
+// offered first, and the new ones are added to it. It returns false when
+// the user cancels or the filled in command is blocked.
+func fillPlaceholders(m *model.Model, result model.Result, known map[string]string) (model.Result, bool, error) {
+	names := result.PlaceholderNames()
+	if len(names) == 0 {
+		return result, true, nil
+	}
+	declared := make(map[string]model.Placeholder)
+	for _, placeholder := range result.Placeholders {
+		declared[placeholder.Name] = placeholder
+	}
+	fields := make([]components.FormField, len(names))
+	for i, name := range names {
+		placeholder, ok := declared[name]
+		if !ok {
+			placeholder = model.Placeholder{Name: name}
+		}
+		value := placeholder.Default
+		if previous, ok := known[name]; ok {
+			value = previous
+		}
+		fields[i] = components.FormField{
+			Label:       name,
+			Description: placeholder.Description,
+			Value:       value,
+			Path:        placeholder.IsPath(),
+		}
+	}
+
+	values, ok, err := components.Form("Fill in the placeholders:", fields)
+	if err != nil || !ok {
+		return result, false, err
+	}
+	filled := make(map[string]string, len(names))
+	for i, name := range names {
+		filled[name] = values[i]
+		if known != nil {
+			known[name] = values[i]
+		}
+	}
+	result, err = m.FillPlaceholders(result, filled)
+	if err != nil {
+		return result, false, fmt.Errorf("failed to fill in the placeholders: %w", err)
+	}
+	fmt.Printf("$ %s\n", renderCommandLine(result))
+	if result.Decision.Blocked() {
+		fmt.Fprintln(os.Stderr, blockedStyle.Render("Blocked by policy: "+strings.Join(result.Decision.Reasons, "; ")))
+		return result, false, nil
+	}
+	return result, true, nil
+}
+
+// previewResult dry-runs result in a copy of the working directory and
+// prints what it would change. The safety policy applies as to running
+// it: blocked commands are not previewed and the others that need
+// confirmation are previewed only once the user confirms.
+func previewResult(cfg model.Config, result model.Result) error {
+	allowed, err := confirmRun(cfg, result)
+	if err != nil || !allowed {
+		return err
+	}
+	dir, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+	fmt.Println(hintStyle.Render("Previewing in a copy of " + dir + " ..."))
+	report, err := model.Preview(context.Background(), result, dir)
+	if err != nil {
+		return err
+	}
+	fmt.Print(renderPreview(report))
+	return nil
+}
+
+// confirmRun applies the safety policy before result is run: nothing runs
+// when the organisation policy disables execution, blocked commands never
+// run, and commands that need confirmation run only after the user types
+// the name of the command that needs it.
+func confirmRun(cfg model.Config, result model.Result) (bool, error) {
+	if cfg.Org.DisableExecution {
+		return false, fmt.Errorf("running commands is disabled by %s", cfg.Org.Path)
+	}
+	decision := result.Decision
+	if decision.Blocked() {
+		return false, fmt.Errorf("blocked by policy: %s", strings.Join(decision.Reasons, "; "))
+	}
+	if !decision.NeedsConfirmation() {
+		return true, nil
+	}
+
+	// The name typed is that of the command the rule is about, not of a
+	// wrapper such as sudo or sh -c around it.
+	name := decision.Command
+	if name == "" {
+		name = filepath.Base(result.Cmd)
+	}
+	fmt.Printf("%s\n", warningStyle.Render("This command "+strings.Join(decision.Reasons, " and ")+"."))
+	fmt.Printf("Type %s to run it: ", commandStyle.Render(name))
+	answer, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && answer == "" {
+		return false, nil
+	}
+	if strings.TrimSpace(answer) != name {
+		fmt.Println("Not running it.")
+		return false, nil
+	}
+	return true, nil
 }
 
 // Execute adds all child commands to the root command and sets flags appropriately.
@@ -91,6 +477,9 @@ Special commands:
 func Execute() {
 	err := rootCmd.Execute()
 	if err != nil {
+		// Errors are silenced so that cobra does not print usage with
+		// them; subcommand errors still need reporting.
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 		os.Exit(1)
 	}
 }
@@ -105,4 +494,9 @@ func init() {
 	// Cobra also supports local flags, which will only run
 	// when this action is called directly.
 	rootCmd.Flags().BoolP("toggle", "t", false, "Help message for toggle")
+	rootCmd.Flags().Bool("show-context", false, "Print the environment context sent to the model")
+	rootCmd.Flags().BoolP("workspace", "w", false, "Include the files and project tasks of the current directory in the context")
+	rootCmd.Flags().Bool("no-interactive", false, "Only print the suggestions, do not prompt for a choice")
+	rootCmd.Flags().Bool("preview", false, "Dry-run the chosen command in a copy of the working directory before deciding to run it")
+	rootCmd.Flags().Bool("agent", false, "When the command fails, ask the model for a fix and offer to run it")
 }
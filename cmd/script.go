@@ -0,0 +1,66 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/samanar/clai/model"
+	"github.com/spf13/cobra"
+)
+
+// scriptCmd represents the script command
+var scriptCmd = &cobra.Command{
+	Use:   "script [task]",
+	Short: "Turn a task into a complete shell script",
+	Long: `Ask the model for the steps of a task and write them out as a bash
+script in strict mode (set -euo pipefail), with a comment for every step.
+Values the script needs become options, described by its --help. The
+script is checked with bash -n before it is written, and made executable.
+
+Without --output the script is printed.
+
+Examples:
+  clai script -o backup.sh back up /etc to a dated tarball in a directory
+  clai script rotate the nginx logs older than a week > rotate.sh`,
+	Args:         cobra.MinimumNArgs(1),
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		task := strings.Join(args, " ")
+		m, err := model.NewModel()
+		if err != nil {
+			return fmt.Errorf("failed to initialize model: %w", err)
+		}
+		if err := m.EnsureAssets(); err != nil {
+			return fmt.Errorf("failed to ensure assets: %w", err)
+		}
+
+		plan, err := m.Plan(task)
+		if err != nil {
+			return fmt.Errorf("failed to write the script: %w", err)
+		}
+		// The steps go to stderr, so that the script alone can be redirected.
+		for i, step := range plan.Steps {
+			cmd.PrintErrf("%s\n", renderStep(i+1, step))
+		}
+
+		script := plan.Script()
+		output, _ := cmd.Flags().GetString("output")
+		if output == "" {
+			if err := model.CheckScript(script); err != nil {
+				return err
+			}
+			fmt.Print(script)
+			return nil
+		}
+		if err := model.WriteScript(output, script); err != nil {
+			return fmt.Errorf("failed to write %s: %w", output, err)
+		}
+		cmd.PrintErrf("Wrote %s\n", output)
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(scriptCmd)
+	scriptCmd.Flags().StringP("output", "o", "", "Write the script to this file and make it executable")
+}
@@ -0,0 +1,78 @@
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/samanar/clai/model"
+	"github.com/spf13/cobra"
+)
+
+// undoCmd represents the undo command
+var undoCmd = &cobra.Command{
+	Use:   "undo",
+	Short: "Restore the files changed by the last command run through clai",
+	Long: `Restore the files the last command run through clai changed, from the
+backup taken just before it ran. Paths the command created are removed.
+
+Backups are kept in the cache directory and expire after a week.`,
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := model.NewConfig()
+		if err != nil {
+			return fmt.Errorf("failed to load config: %w", err)
+		}
+
+		list, _ := cmd.Flags().GetBool("list")
+		if list {
+			snapshots, err := model.ListSnapshots(cfg.Undo)
+			if err != nil {
+				return fmt.Errorf("failed to list backups: %w", err)
+			}
+			if len(snapshots) == 0 {
+				fmt.Println("No backups")
+			}
+			for _, snapshot := range snapshots {
+				fmt.Printf("%s  %s\n", snapshot.Time.Format(time.DateTime), snapshot.Command)
+			}
+			return nil
+		}
+
+		snapshot, err := model.LatestSnapshot(cfg.Undo)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Undo %s\n", commandStyle.Render(snapshot.Command))
+		fmt.Println(hintStyle.Render(fmt.Sprintf("run in %s at %s", snapshot.Cwd, snapshot.Time.Format(time.DateTime))))
+		for _, entry := range snapshot.Entries {
+			if entry.Existed {
+				fmt.Println(modifiedStyle.Render("~ restore " + entry.Path))
+			} else {
+				fmt.Println(deletedStyle.Render("- remove  " + entry.Path))
+			}
+		}
+
+		yes, _ := cmd.Flags().GetBool("yes")
+		if !yes {
+			fmt.Print("Proceed? [y/N] ")
+			answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+			if answer = strings.ToLower(strings.TrimSpace(answer)); answer != "y" && answer != "yes" {
+				return nil
+			}
+		}
+		if err := snapshot.Restore(); err != nil {
+			return err
+		}
+		fmt.Println("✓ Restored")
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(undoCmd)
+	undoCmd.Flags().Bool("list", false, "List the backups that can be restored, newest first")
+	undoCmd.Flags().BoolP("yes", "y", false, "Restore without asking")
+}
@@ -0,0 +1,155 @@
+package components
+
+import (
+	"fmt"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+var (
+	skippedStyle = lipgloss.NewStyle().Foreground(lipgloss.Color("240")).Strikethrough(true)
+	messageStyle = lipgloss.NewStyle().Foreground(lipgloss.Color("208")).PaddingLeft(2)
+)
+
+// ChecklistStatus is how far a checklist item got
+type ChecklistStatus int
+
+const (
+	ChecklistPending ChecklistStatus = iota
+	ChecklistDone
+	ChecklistSkipped
+	ChecklistFailed
+)
+
+// ChecklistItem represents one line of a checklist
+type ChecklistItem struct {
+	Title  string
+	Detail string   // Shown under the title, such as a command line
+	Notes  []string // Shown only for the current item
+	Status ChecklistStatus
+}
+
+// ChecklistAction is a key the user can press for the current item
+type ChecklistAction struct {
+	Key   string
+	Label string
+	Value string // The value to return when pressed
+}
+
+// ChecklistModel represents a checklist worked through in order
+type ChecklistModel struct {
+	items    []ChecklistItem
+	current  int
+	actions  []ChecklistAction
+	message  string
+	selected string
+	done     bool
+}
+
+// NewChecklistModel creates a checklist model with current as the item
+// the actions apply to
+func NewChecklistModel(items []ChecklistItem, current int, actions []ChecklistAction, message string) ChecklistModel {
+	return ChecklistModel{
+		items:   items,
+		current: current,
+		actions: actions,
+		message: message,
+	}
+}
+
+// Init initializes the checklist model
+func (m ChecklistModel) Init() tea.Cmd {
+	return nil
+}
+
+// Update handles messages for the checklist model
+func (m ChecklistModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	if msg, ok := msg.(tea.KeyMsg); ok {
+		switch msg.String() {
+		case "ctrl+c", "q", "esc":
+			m.done = true
+			return m, tea.Quit
+		case "enter":
+			if len(m.actions) > 0 {
+				m.selected = m.actions[0].Value
+			}
+			m.done = true
+			return m, tea.Quit
+		}
+		for _, action := range m.actions {
+			if msg.String() == action.Key {
+				m.selected = action.Value
+				m.done = true
+				return m, tea.Quit
+			}
+		}
+	}
+	return m, nil
+}
+
+// View renders the checklist
+func (m ChecklistModel) View() string {
+	if m.done {
+		return ""
+	}
+
+	var s strings.Builder
+	s.WriteString("\n")
+	for i, item := range m.items {
+		marker := "·"
+		title := titleStyle.Render(item.Title)
+		switch {
+		case item.Status == ChecklistDone:
+			marker = checkMark.String()
+		case item.Status == ChecklistFailed:
+			marker = errorStyle.Render("✗")
+		case item.Status == ChecklistSkipped:
+			marker = descriptionStyle.Render("–")
+			title = skippedStyle.Render(item.Title)
+		case i == m.current:
+			marker = cursorStyle.Render("▶")
+			title = selectedStyle.UnsetPaddingLeft().Render(item.Title)
+		}
+		s.WriteString(fmt.Sprintf("  %s %d. %s\n", marker, i+1, title))
+		if item.Detail != "" {
+			s.WriteString(descriptionStyle.Render("       "+item.Detail) + "\n")
+		}
+		if i == m.current {
+			for _, note := range item.Notes {
+				s.WriteString(descriptionStyle.Render("       "+note) + "\n")
+			}
+		}
+	}
+	if m.message != "" {
+		s.WriteString("\n" + messageStyle.Render(m.message) + "\n")
+	}
+
+	keys := make([]string, 0, len(m.actions)+1)
+	for _, action := range m.actions {
+		keys = append(keys, fmt.Sprintf("%s %s", action.Key, action.Label))
+	}
+	keys = append(keys, "q quit")
+	s.WriteString("\n  " + strings.Join(keys, " · ") + "\n")
+	return s.String()
+}
+
+// Selected returns the value of the action pressed
+func (m ChecklistModel) Selected() string {
+	return m.selected
+}
+
+// Checklist displays the items with current highlighted and returns the
+// value of the action pressed for it, or "" when the user quits
+func Checklist(items []ChecklistItem, current int, actions []ChecklistAction, message string) (string, error) {
+	p := tea.NewProgram(NewChecklistModel(items, current, actions, message))
+
+	finalModel, err := p.Run()
+	if err != nil {
+		return "", fmt.Errorf("error running checklist: %w", err)
+	}
+
+	checklistModel := finalModel.(ChecklistModel)
+	return checklistModel.Selected(), nil
+}
@@ -0,0 +1,205 @@
+package components
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// maxCompletions is how many file names are listed when Tab matches several
+const maxCompletions = 8
+
+// FormField represents one value asked for in a form
+type FormField struct {
+	Label       string
+	Description string
+	Value       string // The default, ready to edit
+	Path        bool   // Tab completes file names from the working directory
+}
+
+// FormModel represents a form of one line fields
+type FormModel struct {
+	title       string
+	fields      []FormField
+	editors     []lineEditor
+	focus       int
+	completions []string // Listed for the focused field after Tab
+	done        bool
+	cancelled   bool
+}
+
+// NewFormModel creates a new form model with the first field focused
+func NewFormModel(title string, fields []FormField) FormModel {
+	editors := make([]lineEditor, len(fields))
+	for i, field := range fields {
+		editors[i] = newLineEditor(field.Value)
+	}
+	return FormModel{
+		title:   title,
+		fields:  fields,
+		editors: editors,
+	}
+}
+
+// Init initializes the form model
+func (m FormModel) Init() tea.Cmd {
+	return nil
+}
+
+// Update handles messages for the form model
+func (m FormModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	key, ok := msg.(tea.KeyMsg)
+	if !ok {
+		return m, nil
+	}
+	m.completions = nil
+	switch key.Type {
+	case tea.KeyCtrlC, tea.KeyEsc:
+		m.cancelled = true
+		m.done = true
+		return m, tea.Quit
+	case tea.KeyEnter:
+		if m.focus == len(m.fields)-1 {
+			m.done = true
+			return m, tea.Quit
+		}
+		m.focus++
+	case tea.KeyTab:
+		if m.fields[m.focus].Path {
+			m.complete()
+		} else {
+			m.focus = (m.focus + 1) % len(m.fields)
+		}
+	case tea.KeyDown:
+		m.focus = (m.focus + 1) % len(m.fields)
+	case tea.KeyShiftTab, tea.KeyUp:
+		m.focus = (m.focus + len(m.fields) - 1) % len(m.fields)
+	default:
+		m.editors[m.focus].handleKey(key)
+	}
+	return m, nil
+}
+
+// complete completes the focused field as far as the file names matching
+// it agree, and lists them when there are several.
+func (m *FormModel) complete() {
+	editor := &m.editors[m.focus]
+	value, matches := completePath(editor.String())
+	*editor = newLineEditor(value)
+	if len(matches) > 1 {
+		m.completions = matches
+	}
+}
+
+// completePath returns value completed to the longest prefix shared by
+// the file names it matches, relative to the working directory, along
+// with those names. Directories end in a slash.
+func completePath(value string) (string, []string) {
+	dir, prefix := filepath.Split(value)
+	readDir := dir
+	switch {
+	case readDir == "":
+		readDir = "."
+	case strings.HasPrefix(readDir, "~/"):
+		if home, err := os.UserHomeDir(); err == nil {
+			readDir = home + readDir[1:]
+		}
+	}
+	entries, err := os.ReadDir(readDir)
+	if err != nil {
+		return value, nil
+	}
+
+	var matches []string
+	for _, entry := range entries {
+		name := entry.Name()
+		// Hidden files only match when asked for, as in a shell.
+		if !strings.HasPrefix(name, prefix) || strings.HasPrefix(name, ".") && !strings.HasPrefix(prefix, ".") {
+			continue
+		}
+		if info, err := os.Stat(filepath.Join(readDir, name)); err == nil && info.IsDir() {
+			name += "/"
+		}
+		matches = append(matches, name)
+	}
+	if len(matches) == 0 {
+		return value, nil
+	}
+	common := matches[0]
+	for _, match := range matches[1:] {
+		for !strings.HasPrefix(match, common) {
+			common = common[:len(common)-1]
+		}
+	}
+	return dir + common, matches
+}
+
+// View renders the form
+func (m FormModel) View() string {
+	if m.done {
+		return ""
+	}
+
+	var s strings.Builder
+	s.WriteString(promptStyle.Render(m.title) + "\n\n")
+	for i, field := range m.fields {
+		if i == m.focus {
+			s.WriteString(fmt.Sprintf("%s %s %s\n", cursorStyle.Render("▶"), titleStyle.Render(field.Label+":"), m.editors[i].View()))
+		} else {
+			s.WriteString(fmt.Sprintf("  %s %s\n", field.Label+":", m.editors[i].String()))
+		}
+		if field.Description != "" {
+			s.WriteString(descriptionStyle.Render("    "+field.Description) + "\n")
+		}
+		if i == m.focus && len(m.completions) > 0 {
+			shown := m.completions[:min(len(m.completions), maxCompletions)]
+			line := strings.Join(shown, "  ")
+			if len(m.completions) > maxCompletions {
+				line += fmt.Sprintf("  (%d more)", len(m.completions)-maxCompletions)
+			}
+			s.WriteString(messageStyle.Render("  "+line) + "\n")
+		}
+	}
+
+	help := "Enter next field · ↑/↓ move · Esc cancel"
+	if m.focus == len(m.fields)-1 {
+		help = "Enter confirm · ↑/↓ move · Esc cancel"
+	}
+	if m.fields[m.focus].Path {
+		help = "Tab complete · " + help
+	}
+	s.WriteString("\n" + descriptionStyle.Render("  "+help) + "\n")
+	return s.String()
+}
+
+// Values returns the value of each field, in order
+func (m FormModel) Values() []string {
+	values := make([]string, len(m.editors))
+	for i := range m.editors {
+		values[i] = m.editors[i].String()
+	}
+	return values
+}
+
+// Form asks for the value of each field, starting from its default. It
+// returns false when the user cancels.
+func Form(title string, fields []FormField) ([]string, bool, error) {
+	if len(fields) == 0 {
+		return nil, true, nil
+	}
+	p := tea.NewProgram(NewFormModel(title, fields))
+
+	finalModel, err := p.Run()
+	if err != nil {
+		return nil, false, fmt.Errorf("error running form: %w", err)
+	}
+
+	formModel := finalModel.(FormModel)
+	if formModel.cancelled {
+		return nil, false, nil
+	}
+	return formModel.Values(), true, nil
+}
@@ -0,0 +1,149 @@
+package components
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+var (
+	promptStyle      = lipgloss.NewStyle().Bold(true).Foreground(lipgloss.Color("75"))
+	inputCursorStyle = lipgloss.NewStyle().Reverse(true)
+)
+
+// lineEditor holds a line of text being edited and the cursor in it.
+type lineEditor struct {
+	value  []rune
+	cursor int
+}
+
+func newLineEditor(value string) lineEditor {
+	runes := []rune(value)
+	return lineEditor{value: runes, cursor: len(runes)}
+}
+
+func (e *lineEditor) String() string {
+	return string(e.value)
+}
+
+// handleKey applies an editing key and reports whether it was one.
+func (e *lineEditor) handleKey(msg tea.KeyMsg) bool {
+	switch msg.Type {
+	case tea.KeyRunes, tea.KeySpace:
+		runes := msg.Runes
+		if msg.Type == tea.KeySpace {
+			runes = []rune{' '}
+		}
+		e.value = slices.Insert(e.value, e.cursor, runes...)
+		e.cursor += len(runes)
+	case tea.KeyBackspace:
+		if e.cursor > 0 {
+			e.value = slices.Delete(e.value, e.cursor-1, e.cursor)
+			e.cursor--
+		}
+	case tea.KeyDelete:
+		if e.cursor < len(e.value) {
+			e.value = slices.Delete(e.value, e.cursor, e.cursor+1)
+		}
+	case tea.KeyLeft:
+		if e.cursor > 0 {
+			e.cursor--
+		}
+	case tea.KeyRight:
+		if e.cursor < len(e.value) {
+			e.cursor++
+		}
+	case tea.KeyHome, tea.KeyCtrlA:
+		e.cursor = 0
+	case tea.KeyEnd, tea.KeyCtrlE:
+		e.cursor = len(e.value)
+	case tea.KeyCtrlU:
+		e.value = e.value[e.cursor:]
+		e.cursor = 0
+	case tea.KeyCtrlK:
+		e.value = e.value[:e.cursor]
+	default:
+		return false
+	}
+	return true
+}
+
+// View renders the text with the cursor shown on the character under it.
+func (e *lineEditor) View() string {
+	var s strings.Builder
+	s.WriteString(string(e.value[:e.cursor]))
+	if e.cursor < len(e.value) {
+		s.WriteString(inputCursorStyle.Render(string(e.value[e.cursor])))
+		s.WriteString(string(e.value[e.cursor+1:]))
+	} else {
+		s.WriteString(inputCursorStyle.Render(" "))
+	}
+	return s.String()
+}
+
+// InputModel represents a one line text prompt
+type InputModel struct {
+	prompt    string
+	editor    lineEditor
+	done      bool
+	cancelled bool
+}
+
+// NewInputModel creates a new input model with value ready to edit
+func NewInputModel(prompt, value string) InputModel {
+	return InputModel{
+		prompt: prompt,
+		editor: newLineEditor(value),
+	}
+}
+
+// Init initializes the input model
+func (m InputModel) Init() tea.Cmd {
+	return nil
+}
+
+// Update handles messages for the input model
+func (m InputModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	if msg, ok := msg.(tea.KeyMsg); ok {
+		switch msg.Type {
+		case tea.KeyCtrlC, tea.KeyEsc:
+			m.cancelled = true
+			m.done = true
+			return m, tea.Quit
+		case tea.KeyEnter:
+			m.done = true
+			return m, tea.Quit
+		}
+		m.editor.handleKey(msg)
+	}
+	return m, nil
+}
+
+// View renders the input prompt
+func (m InputModel) View() string {
+	if m.done {
+		return ""
+	}
+	return fmt.Sprintf("%s %s\n%s\n", promptStyle.Render(m.prompt), m.editor.View(),
+		descriptionStyle.Render("  Enter to confirm, Esc to cancel"))
+}
+
+// Input asks for one line of text, starting from value. It returns false
+// when the user cancels.
+func Input(prompt, value string) (string, bool, error) {
+	p := tea.NewProgram(NewInputModel(prompt, value))
+
+	finalModel, err := p.Run()
+	if err != nil {
+		return "", false, fmt.Errorf("error running input: %w", err)
+	}
+
+	inputModel := finalModel.(InputModel)
+	if inputModel.cancelled {
+		return "", false, nil
+	}
+	return inputModel.editor.String(), true, nil
+}
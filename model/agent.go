@@ -0,0 +1,101 @@
+package model
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	defaultAgentAttempts = 3
+	maxFailureOutput     = 2 << 10
+)
+
+// AgentConfig controls agent mode, where clai asks the model to fix a
+// command that failed.
+type AgentConfig struct {
+	Enabled     bool `yaml:"enabled,omitempty"`
+	MaxAttempts int  `yaml:"max_attempts,omitempty"`
+}
+
+// Attempts returns how many fixes may be asked for after the first run.
+func (c AgentConfig) Attempts() int {
+	if c.MaxAttempts > 0 {
+		return c.MaxAttempts
+	}
+	return defaultAgentAttempts
+}
+
+// Failure is a command that exited with an error, and the end of what it
+// wrote to standard error.
+type Failure struct {
+	Command  string
+	ExitCode int
+	Stderr   string
+}
+
+func (f Failure) String() string {
+	text := fmt.Sprintf("%s failed with exit code %d", f.Command, f.ExitCode)
+	if stderr := strings.TrimSpace(f.Stderr); stderr != "" {
+		text += " and printed:\n" + stderr
+	}
+	return text
+}
+
+// Fix asks for commands that do userInput after the ones in failures
+// failed. Like Ask, the suggestions are judged by the safety policy, and
+// secrets redacted earlier, including from the failures' output, stay
+// out of the prompt. Commands that already failed are not suggested again.
+func (m *Model) Fix(userInput string, failures []Failure) ([]Result, error) {
+	if m.Secrets == nil {
+		m.Secrets = NewRedactor()
+	}
+	corrections := make([]string, len(failures))
+	failed := make(map[string]struct{})
+	for i, failure := range failures {
+		corrections[i] = failure.String()
+		failed[failure.Command] = struct{}{}
+	}
+	results, err := m.ask(userInput, corrections)
+	fixes := results[:0]
+	for _, result := range results {
+		if _, ok := failed[result.CommandLine()]; !ok {
+			fixes = append(fixes, result)
+		}
+	}
+	return fixes, err
+}
+
+// FailureOutput keeps the last bytes written to it, where a failing
+// command usually explains what went wrong.
+type FailureOutput struct {
+	data      []byte
+	limit     int
+	truncated bool
+}
+
+// NewFailureOutput returns a writer that keeps as much of a command's
+// standard error as is sent back to the model.
+func NewFailureOutput() *FailureOutput {
+	return &FailureOutput{limit: maxFailureOutput}
+}
+
+func (o *FailureOutput) Write(p []byte) (int, error) {
+	o.data = append(o.data, p...)
+	if len(o.data) > o.limit {
+		o.data = append(o.data[:0], o.data[len(o.data)-o.limit:]...)
+		o.truncated = true
+	}
+	return len(p), nil
+}
+
+func (o *FailureOutput) String() string {
+	text := strings.ToValidUTF8(string(o.data), "")
+	if o.truncated {
+		// Start at a whole line.
+		if i := strings.IndexByte(text, '\n'); i >= 0 {
+			text = text[i+1:]
+		}
+		return "...\n" + text
+	}
+	return text
+}
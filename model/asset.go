@@ -1,9 +1,11 @@
 package model
 
 import (
+	"fmt"
 	"os"
 	"path/filepath"
 	"runtime"
+	"strings"
 
 	"github.com/samanar/clai/components"
 )
@@ -15,6 +17,11 @@ type Asset struct {
 	DownloadSize string
 	Executable   bool
 	BaseFolder   string
+	// Dir, when set, is where the file is instead of BaseFolder, as for
+	// assets bundled by an administrator.
+	Dir string
+	// NoDownload makes Ensure fail rather than download a missing file.
+	NoDownload bool
 }
 
 type Manifest struct {
@@ -85,6 +92,9 @@ func GetModel(modelType ModelType) Asset {
 }
 
 func (a Asset) BasePath() (string, error) {
+	if a.Dir != "" {
+		return a.Dir, nil
+	}
 	appDataDir, err := AppDataDir()
 	if err != nil {
 		return "", err
@@ -106,6 +116,9 @@ func (a Asset) Ensure() error {
 		return err
 	}
 	if _, err := os.Stat(fullPath); os.IsNotExist(err) {
+		if a.NoDownload {
+			return fmt.Errorf("%s is missing and downloads are disabled by policy", fullPath)
+		}
 		if err := os.MkdirAll(filepath.Dir(fullPath), os.ModePerm); err != nil {
 			return err
 		}
@@ -138,7 +151,38 @@ func NewManifest() (Manifest, error) {
 
 	model := GetModel(config.Model)
 
-	return Manifest{Llama: llama, Model: model}, nil
+	manifest := Manifest{Llama: llama, Model: model}
+	manifest.applyOrgPolicy(config.Org)
+	return manifest, nil
+}
+
+// applyOrgPolicy points the assets at the bundle or mirror the policy
+// names, and forbids downloading them when it says so.
+func (m *Manifest) applyOrgPolicy(org OrgPolicy) {
+	for _, asset := range []*Asset{&m.Llama, &m.Model} {
+		if org.MirrorURL != "" {
+			asset.URL = strings.TrimSuffix(org.MirrorURL, "/") + "/" + asset.Filename
+		}
+		if org.AssetDir != "" {
+			asset.Dir = org.AssetDir
+			asset.NoDownload = true
+		}
+		if org.NoDownloads && org.MirrorURL == "" {
+			asset.NoDownload = true
+		}
+	}
+}
+
+// CacheDir holds data clai can rebuild at any time, such as the man index.
+func CacheDir() (string, error) {
+	cacheDir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	if runtime.GOOS == "darwin" {
+		return filepath.Join(cacheDir, "Clai"), nil
+	}
+	return filepath.Join(cacheDir, "clai"), nil
 }
 
 func AppDataDir() (string, error) {
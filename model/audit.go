@@ -0,0 +1,242 @@
+package model
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/user"
+	"path/filepath"
+	"time"
+)
+
+const (
+	AUDIT_FILE_NAME        = "audit.jsonl"
+	defaultAuditMaxSizeMB  = 10
+	defaultAuditMaxBackups = 5
+	defaultSyslogSocket    = "/dev/log"
+)
+
+// AuditConfig controls the log of commands run through clai.
+type AuditConfig struct {
+	Enabled    bool   `yaml:"enabled,omitempty"`
+	Path       string `yaml:"path,omitempty"`
+	MaxSizeMB  int    `yaml:"max_size_mb,omitempty"`
+	MaxBackups int    `yaml:"max_backups,omitempty"`
+	// Syslog also sends each entry to the local syslog socket, which
+	// journald listens on as well.
+	Syslog       bool   `yaml:"syslog,omitempty"`
+	SyslogSocket string `yaml:"syslog_socket,omitempty"`
+}
+
+// AuditEvent is what an AuditEntry records about a command.
+type AuditEvent string
+
+const (
+	// AuditStarted is written before the command runs, so that one which
+	// is killed, or outlives clai, is on record too.
+	AuditStarted  AuditEvent = "started"
+	AuditFinished AuditEvent = "finished"
+	// AuditFailed is written when the command could not be started.
+	AuditFailed AuditEvent = "failed"
+)
+
+// AuditEntry is one event of a command run through clai. The entries of
+// one command share an ID.
+type AuditEntry struct {
+	Time       time.Time  `json:"ts"`
+	ID         string     `json:"id"`
+	Event      AuditEvent `json:"event"`
+	User       string     `json:"user"`
+	Host       string     `json:"host"`
+	Cwd        string     `json:"cwd"`
+	Query      string     `json:"query"`
+	Model      ModelType  `json:"model"`
+	Command    string     `json:"command"`
+	ExitCode   *int       `json:"exit_code,omitempty"`
+	DurationMs int64      `json:"duration_ms,omitempty"`
+	Error      string     `json:"error,omitempty"`
+}
+
+// AuditSettings returns the audit settings in effect: the organisation's
+// when it has any, and always enabled when it requires auditing.
+func (cfg *Config) AuditSettings() AuditConfig {
+	settings := cfg.Audit
+	if cfg.Org.Audit != (AuditConfig{}) {
+		settings = cfg.Org.Audit
+	}
+	if cfg.Org.RequireAudit {
+		settings.Enabled = true
+	}
+	return settings
+}
+
+// AuditLog appends entries to a JSON lines file, rotating it when it
+// grows past its size limit. A nil AuditLog records nothing.
+type AuditLog struct {
+	settings AuditConfig
+	path     string
+	required bool
+}
+
+// OpenAuditLog returns the audit log, or nil when auditing is off. It
+// makes sure the file can be written, so that a command that must be
+// audited is not run when it cannot be.
+func OpenAuditLog(cfg Config) (*AuditLog, error) {
+	settings := cfg.AuditSettings()
+	if !settings.Enabled {
+		return nil, nil
+	}
+	path := settings.Path
+	if path == "" {
+		appDataDir, err := AppDataDir()
+		if err != nil {
+			return nil, err
+		}
+		path = filepath.Join(appDataDir, HISTORY_BASE_FOLDER, AUDIT_FILE_NAME)
+	}
+	if settings.MaxSizeMB <= 0 {
+		settings.MaxSizeMB = defaultAuditMaxSizeMB
+	}
+	if settings.MaxBackups <= 0 {
+		settings.MaxBackups = defaultAuditMaxBackups
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, fmt.Errorf("failed to create audit log directory: %w", err)
+	}
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open audit log: %w", err)
+	}
+	file.Close()
+	return &AuditLog{settings: settings, path: path, required: cfg.Org.RequireAudit}, nil
+}
+
+// Required reports whether the organisation policy requires the log.
+func (l *AuditLog) Required() bool {
+	return l != nil && l.required
+}
+
+// Run runs result through the user's shell and records it: a started
+// entry before it runs and a finished one, with its exit code and how
+// long it took, afterwards, or a failed one when it cannot be started.
+// The command's standard error is copied to stderr, if not nil. Secrets
+// are redacted from what is recorded. Failing to record is an error only
+// when the log is required, and then the command is not run unless its
+// start is on record.
+func (l *AuditLog) Run(query string, model ModelType, result Result, secrets *Redactor, stderr io.Writer) (int, error) {
+	start := time.Now()
+	entry := AuditEntry{
+		Time:    start,
+		ID:      fmt.Sprintf("%d-%d", start.UnixNano(), os.Getpid()),
+		Event:   AuditStarted,
+		Query:   secrets.Redact(query),
+		Model:   model,
+		Command: secrets.RedactResult(result).CommandLine(),
+	}
+	if err := l.Record(entry); err != nil {
+		if l.Required() {
+			return 0, fmt.Errorf("not running the command, failed to write audit log: %w", err)
+		}
+		fmt.Fprintf(os.Stderr, "Warning: failed to write audit log: %v\n", err)
+	}
+
+	exitCode, runErr := RunCommandLineCapturing(result.CommandLine(), stderr)
+	entry.Time = time.Now()
+	entry.DurationMs = entry.Time.Sub(start).Milliseconds()
+	if runErr != nil {
+		entry.Event = AuditFailed
+		entry.Error = runErr.Error()
+	} else {
+		entry.Event = AuditFinished
+		entry.ExitCode = &exitCode
+	}
+	if err := l.Record(entry); err != nil {
+		if l.Required() {
+			return exitCode, errors.Join(runErr, fmt.Errorf("failed to write audit log: %w", err))
+		}
+		fmt.Fprintf(os.Stderr, "Warning: failed to write audit log: %v\n", err)
+	}
+	if runErr != nil {
+		return exitCode, fmt.Errorf("failed to run command: %w", runErr)
+	}
+	return exitCode, nil
+}
+
+// Record appends entry, filling in who ran it and where.
+func (l *AuditLog) Record(entry AuditEntry) error {
+	if l == nil {
+		return nil
+	}
+	if entry.User == "" {
+		if current, err := user.Current(); err == nil {
+			entry.User = current.Username
+		}
+	}
+	if entry.Host == "" {
+		entry.Host, _ = os.Hostname()
+	}
+	if entry.Cwd == "" {
+		entry.Cwd, _ = os.Getwd()
+	}
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	if err := l.rotate(int64(len(data) + 1)); err != nil {
+		return err
+	}
+	file, err := os.OpenFile(l.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	if _, err := file.Write(append(data, '\n')); err != nil {
+		return err
+	}
+	if l.settings.Syslog {
+		return l.sendSyslog(data)
+	}
+	return nil
+}
+
+// rotate moves the log to audit.jsonl.1, and older ones up by one, when
+// adding size bytes would take it past the limit. The oldest is dropped.
+func (l *AuditLog) rotate(size int64) error {
+	info, err := os.Stat(l.path)
+	if err != nil || info.Size()+size <= int64(l.settings.MaxSizeMB)<<20 {
+		return nil
+	}
+	os.Remove(fmt.Sprintf("%s.%d", l.path, l.settings.MaxBackups))
+	for i := l.settings.MaxBackups - 1; i >= 1; i-- {
+		os.Rename(fmt.Sprintf("%s.%d", l.path, i), fmt.Sprintf("%s.%d", l.path, i+1))
+	}
+	return os.Rename(l.path, l.path+".1")
+}
+
+// sendSyslog writes the entry to the local syslog socket as an
+// informational message from the user facility.
+func (l *AuditLog) sendSyslog(data []byte) error {
+	socket := l.settings.SyslogSocket
+	if socket == "" {
+		socket = defaultSyslogSocket
+	}
+	var conn net.Conn
+	var err error
+	for _, network := range []string{"unixgram", "unix"} {
+		if conn, err = net.Dial(network, socket); err == nil {
+			break
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("failed to connect to syslog: %w", err)
+	}
+	defer conn.Close()
+	// <14> is facility user (1) with severity info (6).
+	message := fmt.Sprintf("<14>%s clai[%d]: %s", time.Now().Format(time.Stamp), os.Getpid(), data)
+	_, err = conn.Write([]byte(message))
+	return err
+}
@@ -0,0 +1,76 @@
+package model
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func testAuditLog(path string, required bool) *AuditLog {
+	return &AuditLog{
+		settings: AuditConfig{Enabled: true, MaxSizeMB: defaultAuditMaxSizeMB, MaxBackups: defaultAuditMaxBackups},
+		path:     path,
+		required: required,
+	}
+}
+
+func readAuditEntries(t *testing.T, path string) []AuditEntry {
+	t.Helper()
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	var entries []AuditEntry
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var entry AuditEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			t.Fatal(err)
+		}
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+func TestAuditRunRecordsStartAndFinish(t *testing.T) {
+	t.Setenv("SHELL", "/bin/sh")
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	log := testAuditLog(path, true)
+
+	exitCode, err := log.Run("fail on purpose", ModelGemma3_1B, Result{Cmd: "sh", Args: []string{"-c", "exit 3"}}, nil, nil)
+	if err != nil || exitCode != 3 {
+		t.Fatalf("Run = %d, %v; want 3, nil", exitCode, err)
+	}
+	entries := readAuditEntries(t, path)
+	if len(entries) != 2 {
+		t.Fatalf("got %d entries, want started and finished", len(entries))
+	}
+	started, finished := entries[0], entries[1]
+	if started.Event != AuditStarted || started.ExitCode != nil {
+		t.Errorf("first entry = %+v, want a started entry without exit code", started)
+	}
+	if finished.Event != AuditFinished || finished.ExitCode == nil || *finished.ExitCode != 3 {
+		t.Errorf("second entry = %+v, want finished with exit code 3", finished)
+	}
+	if started.ID == "" || started.ID != finished.ID {
+		t.Errorf("entry IDs %q and %q, want the same one", started.ID, finished.ID)
+	}
+}
+
+func TestAuditRunRequiresStartRecord(t *testing.T) {
+	t.Setenv("SHELL", "/bin/sh")
+	dir := t.TempDir()
+	marker := filepath.Join(dir, "ran")
+	// The log's directory is gone, so nothing can be recorded.
+	log := testAuditLog(filepath.Join(dir, "missing", "audit.jsonl"), true)
+
+	if _, err := log.Run("touch it", ModelGemma3_1B, Result{Cmd: "touch", Args: []string{marker}}, nil, nil); err == nil {
+		t.Error("Run: got no error without an audit record")
+	}
+	if _, err := os.Stat(marker); err == nil {
+		t.Error("the command ran although its start could not be recorded")
+	}
+}
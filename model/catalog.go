@@ -0,0 +1,250 @@
+package model
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// CatalogEntry describes an in-house command that has no man page. Teams
+// keep these in YAML or Markdown files in a shared repository and point
+// index.catalogs in config.yml at the checkout.
+type CatalogEntry struct {
+	Name        string           `yaml:"name"`
+	Description string           `yaml:"description"`
+	Usage       string           `yaml:"usage,omitempty"`
+	Flags       []CatalogFlag    `yaml:"flags,omitempty"`
+	Examples    []CatalogExample `yaml:"examples,omitempty"`
+}
+
+type CatalogFlag struct {
+	Flag        string `yaml:"flag"`
+	Description string `yaml:"description"`
+}
+
+type CatalogExample struct {
+	Description string `yaml:"description"`
+	Command     string `yaml:"command"`
+}
+
+type catalogFile struct {
+	Commands []CatalogEntry `yaml:"commands"`
+}
+
+// readCatalogFile parses one catalog file. YAML files hold either a single
+// entry or a "commands" list; Markdown files use the tldr layout.
+func readCatalogFile(path string) ([]CatalogEntry, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var entries []CatalogEntry
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yml", ".yaml":
+		var file catalogFile
+		if err := yaml.Unmarshal(data, &file); err != nil {
+			return nil, fmt.Errorf("failed to parse catalog %s: %w", path, err)
+		}
+		entries = file.Commands
+		if len(entries) == 0 {
+			var entry CatalogEntry
+			if err := yaml.Unmarshal(data, &entry); err != nil {
+				return nil, fmt.Errorf("failed to parse catalog %s: %w", path, err)
+			}
+			entries = []CatalogEntry{entry}
+		}
+	case ".md":
+		entries = []CatalogEntry{parseCatalogMarkdown(string(data), path)}
+	default:
+		return nil, fmt.Errorf("unsupported catalog file %s", path)
+	}
+
+	var valid []CatalogEntry
+	for _, entry := range entries {
+		if entry.Name = strings.TrimSpace(entry.Name); entry.Name != "" {
+			valid = append(valid, entry)
+		}
+	}
+	if len(valid) == 0 {
+		return nil, fmt.Errorf("no commands in catalog %s", path)
+	}
+	return valid, nil
+}
+
+// parseCatalogMarkdown reads a tldr style page:
+//
+//	# deployctl
+//	> Deploy services to our clusters.
+//	> Usage: deployctl <service> --env <env>
+//	## Flags
+//	- `--env, -e <env>`: target environment (staging, prod)
+//	## Examples
+//	- Deploy the api to staging:
+//	`deployctl api --env staging`
+//
+// The headings are optional; a bullet starting with a backticked flag is a
+// flag, any other bullet describes the example on the next code line.
+func parseCatalogMarkdown(text, path string) CatalogEntry {
+	entry := CatalogEntry{Name: strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))}
+	var description []string
+	pendingExample := ""
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(line)
+		switch {
+		case strings.HasPrefix(line, "# "):
+			entry.Name = strings.TrimSpace(strings.TrimPrefix(line, "# "))
+		case strings.HasPrefix(line, "> "):
+			quote := strings.TrimSpace(strings.TrimPrefix(line, "> "))
+			if usage, ok := strings.CutPrefix(quote, "Usage:"); ok {
+				entry.Usage = strings.Trim(strings.TrimSpace(usage), "`")
+				continue
+			}
+			description = append(description, quote)
+		case strings.HasPrefix(line, "- `-"):
+			tag, body, _ := strings.Cut(strings.TrimPrefix(line, "- `"), "`")
+			entry.Flags = append(entry.Flags, CatalogFlag{
+				Flag:        tag,
+				Description: strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(body), ":")),
+			})
+		case strings.HasPrefix(line, "- "):
+			pendingExample = strings.TrimSuffix(strings.TrimPrefix(line, "- "), ":")
+		case strings.HasPrefix(line, "`") && strings.HasSuffix(line, "`") && len(line) > 1:
+			entry.Examples = append(entry.Examples, CatalogExample{
+				Description: pendingExample,
+				Command:     strings.Trim(line, "`"),
+			})
+			pendingExample = ""
+		}
+	}
+	entry.Description = strings.Join(description, " ")
+	return entry
+}
+
+// ManText renders the entry in man page layout, so that buildManExcerpt
+// picks its flags and examples the same way it does for real pages.
+func (e CatalogEntry) ManText() string {
+	var builder strings.Builder
+	builder.WriteString("NAME\n")
+	builder.WriteString(fmt.Sprintf("       %s - %s\n", e.Name, e.Description))
+	if e.Usage != "" {
+		builder.WriteString("SYNOPSIS\n")
+		for _, line := range strings.Split(strings.TrimSpace(e.Usage), "\n") {
+			builder.WriteString("       " + line + "\n")
+		}
+	}
+	if len(e.Flags) > 0 {
+		builder.WriteString("OPTIONS\n")
+		for _, flag := range e.Flags {
+			builder.WriteString("       " + flag.Flag + "\n")
+			builder.WriteString("              " + flag.Description + "\n")
+		}
+	}
+	if len(e.Examples) > 0 {
+		builder.WriteString("EXAMPLES\n")
+		for _, example := range e.Examples {
+			if example.Description != "" {
+				builder.WriteString("       # " + example.Description + "\n")
+			}
+			builder.WriteString("       " + example.Command + "\n")
+		}
+	}
+	return builder.String()
+}
+
+// catalogFiles lists the catalog files below dir, including subdirectories
+// so that teams can group their tools.
+func catalogFiles(dir string) []string {
+	var files []string
+	filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if entry.IsDir() {
+			if path != dir && strings.HasPrefix(entry.Name(), ".") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		switch strings.ToLower(filepath.Ext(path)) {
+		case ".yml", ".yaml", ".md":
+			if !strings.EqualFold(entry.Name(), "README.md") {
+				files = append(files, path)
+			}
+		}
+		return nil
+	})
+	return files
+}
+
+// fingerprintCatalogDir also tracks file modification times, because a
+// pull that edits a catalog in place does not touch the directory.
+func fingerprintCatalogDir(dir string) (dirFingerprint, bool) {
+	info, err := os.Stat(dir)
+	if err != nil || !info.IsDir() {
+		return dirFingerprint{}, false
+	}
+	fingerprint := dirFingerprint{ModTime: info.ModTime().UnixNano()}
+	for _, path := range catalogFiles(dir) {
+		fileInfo, err := os.Stat(path)
+		if err != nil {
+			continue
+		}
+		fingerprint.Entries++
+		fingerprint.ModTime = max(fingerprint.ModTime, fileInfo.ModTime().UnixNano())
+	}
+	return fingerprint, true
+}
+
+// resolveCatalogDirs expands a leading ~/ in the configured directories
+// and resolves relative ones against the directory of config.yml, so that
+// they mean the same wherever clai runs.
+func resolveCatalogDirs(configured []string) []string {
+	home, _ := os.UserHomeDir()
+	configDir, _ := (&Config{}).BasePath()
+	var dirs []string
+	for _, dir := range configured {
+		switch {
+		case strings.HasPrefix(dir, "~/") && home != "":
+			dir = filepath.Join(home, dir[2:])
+		case !filepath.IsAbs(dir) && configDir != "":
+			dir = filepath.Join(configDir, dir)
+		}
+		if abs, err := filepath.Abs(dir); err == nil {
+			dir = abs
+		}
+		dirs = append(dirs, dir)
+	}
+	return dirs
+}
+
+// readCatalogEntry loads the entry for name from the catalog file at path.
+func readCatalogEntry(path, name string) (CatalogEntry, error) {
+	entries, err := readCatalogFile(path)
+	if err != nil {
+		return CatalogEntry{}, err
+	}
+	for _, entry := range entries {
+		if entry.Name == name {
+			return entry, nil
+		}
+	}
+	return CatalogEntry{}, fmt.Errorf("%s is no longer in catalog %s", name, path)
+}
+
+func indexCatalogEntry(entry CatalogEntry) map[string]int {
+	terms := make(map[string]int)
+	addNameTerms(terms, entry.Name)
+	addTerms(terms, entry.Description, manIndexSummaryWeight)
+	addTerms(terms, entry.Usage, manIndexSynopsisWeight)
+	for _, flag := range entry.Flags {
+		addTerms(terms, flag.Description, 1)
+	}
+	for _, example := range entry.Examples {
+		addTerms(terms, example.Description, 1)
+	}
+	return terms
+}
@@ -0,0 +1,42 @@
+package model
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCatalogDirsFollowConfig(t *testing.T) {
+	data := t.TempDir()
+	t.Setenv("HOME", data)
+	t.Setenv("XDG_DATA_HOME", data)
+	configDir, err := (&Config{}).BasePath()
+	if err != nil {
+		t.Fatal(err)
+	}
+	catalog := filepath.Join(configDir, "catalog")
+	if err := os.MkdirAll(catalog, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	entry := "name: deployctl\ndescription: Deploy services to the company clusters\n"
+	if err := os.WriteFile(filepath.Join(catalog, "deployctl.yml"), []byte(entry), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	// Wherever clai runs, the relative path means the same directory.
+	t.Chdir(t.TempDir())
+
+	cfg := IndexConfig{Catalogs: []string{"catalog"}}
+	if dirs := resolveCatalogDirs(cfg.Catalogs); len(dirs) != 1 || dirs[0] != catalog {
+		t.Fatalf("resolveCatalogDirs = %q, want [%s]", dirs, catalog)
+	}
+	index := readCatalogIndex(cfg)
+	if doc, ok := index.Lookup("deployctl"); !ok || doc.CatalogPath == "" {
+		t.Errorf("Lookup(deployctl) = %v, %v; want the catalog entry", doc, ok)
+	}
+	if got := index.Search([]string{"deploy", "services"}, 2); len(got) != 1 || got[0] != "deployctl" {
+		t.Errorf("Search = %q, want [deployctl]", got)
+	}
+	if index.hasManPages() {
+		t.Error("a catalog index claims to cover the man pages")
+	}
+}
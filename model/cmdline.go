@@ -0,0 +1,230 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// cmdlineToken is a word or an operator of a command line typed by the
+// user.
+type cmdlineToken struct {
+	text     string
+	operator bool
+}
+
+// redirectOps are the redirections a Result can hold, longest first so
+// that 2>> is not read as 2>.
+var redirectOps = []string{"2>&1", "2>>", "2>", "&>", ">>", ">", "<"}
+
+// stageOps are the operators joining pipeline stages.
+var stageOps = []string{"&&", "||", "|", ";"}
+
+// ParseCommandLine turns a command line typed by the user into a Result:
+// its words with quotes removed, pipeline stages and redirects. Line keeps
+// the text as typed, which is what runs. Only what Result can express is
+// understood; subshells, background jobs and here-documents are not.
+func ParseCommandLine(line string) (Result, error) {
+	tokens, err := splitCommandLine(line)
+	if err != nil {
+		return Result{}, err
+	}
+	var stages []Stage
+	stage := Stage{}
+	started := false
+	for i := 0; i < len(tokens); i++ {
+		token := tokens[i]
+		switch {
+		case !token.operator:
+			if !started {
+				stage.Cmd = token.text
+				started = true
+			} else {
+				stage.Args = append(stage.Args, token.text)
+			}
+		case isStageOp(token.text):
+			if !started {
+				return Result{}, fmt.Errorf("missing command before %s", token.text)
+			}
+			stages = append(stages, stage)
+			stage = Stage{Op: token.text}
+			started = false
+		default:
+			redirect := Redirect{Op: token.text}
+			if token.text != "2>&1" {
+				if i+1 == len(tokens) || tokens[i+1].operator {
+					return Result{}, fmt.Errorf("missing file after %s", token.text)
+				}
+				i++
+				redirect.Target = tokens[i].text
+			}
+			stage.Redirects = append(stage.Redirects, redirect)
+		}
+	}
+	switch {
+	case started:
+		stages = append(stages, stage)
+	case stage.Op == ";" && len(stages) > 0:
+		// A trailing ; ends the line.
+	case len(stages) == 0 && len(stage.Redirects) == 0:
+		return Result{}, errors.New("the command line is empty")
+	default:
+		return Result{}, fmt.Errorf("missing command after %s", stage.Op)
+	}
+
+	result := Result{
+		Cmd:       stages[0].Cmd,
+		Args:      stages[0].Args,
+		Redirects: stages[0].Redirects,
+		Pipeline:  stages[1:],
+		Line:      strings.TrimSpace(line),
+	}
+	if len(result.Pipeline) == 0 {
+		result.Pipeline = nil
+	}
+	return result, nil
+}
+
+// splitCommandLine splits line into words and operators, removing quotes
+// and backslashes. Variables and command substitutions are kept as text.
+func splitCommandLine(line string) ([]cmdlineToken, error) {
+	var tokens []cmdlineToken
+	var word strings.Builder
+	inWord := false
+	flush := func() {
+		if inWord {
+			tokens = append(tokens, cmdlineToken{text: word.String()})
+			word.Reset()
+			inWord = false
+		}
+	}
+
+	for i := 0; i < len(line); {
+		c := line[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n':
+			flush()
+			i++
+		case c == '\'':
+			end := strings.IndexByte(line[i+1:], '\'')
+			if end < 0 {
+				return nil, errors.New("unterminated ' quote")
+			}
+			word.WriteString(line[i+1 : i+1+end])
+			inWord = true
+			i += end + 2
+		case c == '"':
+			n, err := readDoubleQuoted(line[i:], &word)
+			if err != nil {
+				return nil, err
+			}
+			inWord = true
+			i += n
+		case c == '\\':
+			if i+1 < len(line) {
+				word.WriteByte(line[i+1])
+			}
+			inWord = true
+			i += 2
+		case c == '$' && expansionLength(line[i:]) > 0:
+			n := expansionLength(line[i:])
+			word.WriteString(line[i : i+n])
+			inWord = true
+			i += n
+		case c == '`':
+			end := strings.IndexByte(line[i+1:], '`')
+			if end < 0 {
+				return nil, errors.New("unterminated ` quote")
+			}
+			word.WriteString(line[i : i+end+2])
+			inWord = true
+			i += end + 2
+		case c == '&' && !inWord && i+1 < len(line) && line[i+1] >= '0' && line[i+1] <= '9' && afterRedirect(tokens):
+			// >&2 duplicates a descriptor; &2 is its target.
+			word.WriteByte(c)
+			inWord = true
+			i++
+		case c == '(' || c == ')':
+			return nil, errors.New("subshells are not supported")
+		default:
+			if op, n := operatorAt(line[i:], inWord && word.String() == "2"); op != "" {
+				switch {
+				case op == "&":
+					return nil, errors.New("background jobs are not supported")
+				case strings.HasPrefix(line[i:], "<<"):
+					return nil, errors.New("here-documents are not supported")
+				case strings.HasPrefix(op, "2"):
+					// The 2 read as a word belongs to the operator.
+					word.Reset()
+					inWord = false
+				}
+				flush()
+				tokens = append(tokens, cmdlineToken{text: op, operator: true})
+				i += n
+				continue
+			}
+			word.WriteByte(c)
+			inWord = true
+			i++
+		}
+	}
+	flush()
+	return tokens, nil
+}
+
+// operatorAt returns the operator s starts with and its length in s, if
+// any. afterTwo is set when the word so far is a bare 2, which makes >
+// part of 2> and friends.
+func operatorAt(s string, afterTwo bool) (string, int) {
+	if afterTwo && strings.HasPrefix(s, ">") {
+		for _, op := range redirectOps {
+			if strings.HasPrefix(op, "2") && strings.HasPrefix("2"+s, op) {
+				return op, len(op) - 1
+			}
+		}
+	}
+	for _, op := range append(append([]string{}, stageOps...), redirectOps...) {
+		if !strings.HasPrefix(op, "2") && strings.HasPrefix(s, op) {
+			return op, len(op)
+		}
+	}
+	if strings.HasPrefix(s, "&") {
+		return "&", 1
+	}
+	return "", 0
+}
+
+func afterRedirect(tokens []cmdlineToken) bool {
+	if len(tokens) == 0 {
+		return false
+	}
+	last := tokens[len(tokens)-1]
+	return last.operator && !isStageOp(last.text)
+}
+
+func isStageOp(op string) bool {
+	for _, stageOp := range stageOps {
+		if op == stageOp {
+			return true
+		}
+	}
+	return false
+}
+
+// readDoubleQuoted reads the double quoted string at the start of s into
+// word and returns its length. Backslashes escape only what they escape
+// in the shell; variables and substitutions are kept as text.
+func readDoubleQuoted(s string, word *strings.Builder) (int, error) {
+	for i := 1; i < len(s); i++ {
+		switch c := s[i]; {
+		case c == '"':
+			return i + 1, nil
+		case c == '\\' && i+1 < len(s) && strings.IndexByte("$`\"\\\n", s[i+1]) >= 0:
+			i++
+			word.WriteByte(s[i])
+		default:
+			word.WriteByte(c)
+		}
+	}
+	return 0, errors.New(`unterminated " quote`)
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"slices"
 
 	"github.com/samanar/clai/components"
 	"gopkg.in/yaml.v3"
@@ -13,7 +14,22 @@ const CONFIG_FILE_NAME = "config.yml"
 const CONFIG_FILE_BASE_FOLDER = "config"
 
 type Config struct {
-	Model ModelType `yaml:"model"`
+	Model       ModelType         `yaml:"model"`
+	Environment EnvironmentConfig `yaml:"environment,omitempty"`
+	Workspace   WorkspaceConfig   `yaml:"workspace,omitempty"`
+	Git         GitConfig         `yaml:"git,omitempty"`
+	Index       IndexConfig       `yaml:"index,omitempty"`
+	References  ReferenceConfig   `yaml:"references,omitempty"`
+	Prompt      PromptConfig      `yaml:"prompt,omitempty"`
+	Validation  ValidationConfig  `yaml:"validation,omitempty"`
+	Policy      PolicyConfig      `yaml:"policy,omitempty"`
+	Audit       AuditConfig       `yaml:"audit,omitempty"`
+	Undo        UndoConfig        `yaml:"undo,omitempty"`
+	Agent       AgentConfig       `yaml:"agent,omitempty"`
+
+	// Org is the organisation policy, which overrides the settings above.
+	// It is read from ORG_POLICY_FILE and never saved with them.
+	Org OrgPolicy `yaml:"-"`
 }
 
 func NewConfig() (Config, error) {
@@ -102,10 +118,29 @@ func (cfg *Config) Load() error {
 	if err := yaml.Unmarshal(data, &claiConfig); err != nil {
 		return err
 	}
+	org, err := LoadOrgPolicy()
+	if err != nil {
+		return err
+	}
+	claiConfig.Org = org
+	if !org.ModelAllowed(claiConfig.Model) {
+		claiConfig.Model = org.AllowedModels[0]
+	}
 	*cfg = claiConfig
 	return nil
 }
 
+// SafetyPolicy returns the safety policy settings with the organisation's
+// rules added.
+func (cfg *Config) SafetyPolicy() PolicyConfig {
+	policy := cfg.Policy
+	if cfg.Org.LockPolicy {
+		policy = PolicyConfig{}
+	}
+	policy.Rules = append(slices.Clone(policy.Rules), cfg.Org.policyRules()...)
+	return policy
+}
+
 func (cfg *Config) Save() error {
 	configPath, err := cfg.FullPath()
 	if err != nil {
@@ -127,16 +162,25 @@ func (cfg *Config) Save() error {
 func (cfg *Config) UpdatePrompt() error {
 	options := []components.SelectOption{}
 	for _, model := range AllModels {
+		if !cfg.Org.ModelAllowed(ToModelType(model.Filename)) {
+			continue
+		}
 		options = append(options, components.SelectOption{
 			Title:       model.Filename,
 			Description: fmt.Sprintf("%s (Size: %s)", model.Description, model.DownloadSize),
 			Value:       model.Filename,
 		})
 	}
+	if len(options) == 1 {
+		return fmt.Errorf("the model is pinned to %s by %s", options[0].Value, cfg.Org.Path)
+	}
 	selected, err := components.Select(options)
 	if err != nil {
 		return err
 	}
+	if selected == "" {
+		return nil
+	}
 	cfg.Model = ToModelType(selected)
 	if err := cfg.Save(); err != nil {
 		return err
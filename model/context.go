@@ -0,0 +1,57 @@
+package model
+
+import "strings"
+
+// ContextProvider contributes a titled block of facts to the prompt. Providers
+// return an empty string when they have nothing relevant for the query.
+type ContextProvider interface {
+	Name() string
+	Collect(userInput string, keywords []string) string
+}
+
+type ContextSection struct {
+	Title string
+	Body  string
+}
+
+type PromptContext struct {
+	Environment Environment
+	Sections    []ContextSection
+}
+
+// String renders the context the same way it is presented to the model.
+func (pc PromptContext) String() string {
+	var blocks []string
+	if env := pc.Environment.String(); env != "" {
+		blocks = append(blocks, "Environment:\n"+env)
+	}
+	for _, section := range pc.Sections {
+		blocks = append(blocks, section.Title+":\n"+section.Body)
+	}
+	return strings.Join(blocks, "\n\n")
+}
+
+func (m *Model) contextProviders() []ContextProvider {
+	var providers []ContextProvider
+	if m.Config.Workspace.Enabled {
+		providers = append(providers, WorkspaceProvider{config: m.Config.Workspace})
+	}
+	if !m.Config.Git.Disabled {
+		providers = append(providers, GitProvider{})
+	}
+	return providers
+}
+
+// Context collects the environment and every enabled provider for userInput.
+func (m *Model) Context(userInput string) PromptContext {
+	pc := PromptContext{Environment: m.Environment()}
+	keywords := extractKeywords(userInput)
+	for _, provider := range m.contextProviders() {
+		body := strings.TrimSpace(provider.Collect(userInput, keywords))
+		if body == "" {
+			continue
+		}
+		pc.Sections = append(pc.Sections, ContextSection{Title: provider.Name(), Body: body})
+	}
+	return pc
+}
@@ -0,0 +1,247 @@
+package model
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+)
+
+const (
+	EnvFieldOS             = "os"
+	EnvFieldDistro         = "distro"
+	EnvFieldUserland       = "userland"
+	EnvFieldShell          = "shell"
+	EnvFieldCwd            = "cwd"
+	EnvFieldRoot           = "root"
+	EnvFieldPackageManager = "package_manager"
+	EnvFieldTools          = "tools"
+)
+
+var defaultEnvironmentTools = []string{
+	"rg", "fd", "fdfind", "jq", "yq", "docker", "podman", "kubectl",
+	"git", "curl", "wget", "rsync", "python3", "node", "systemctl", "ffmpeg",
+}
+
+// EnvironmentConfig selects which environment facts are added to the prompt.
+type EnvironmentConfig struct {
+	Disable []string `yaml:"disable,omitempty"`
+	Tools   []string `yaml:"tools,omitempty"`
+}
+
+func (ec EnvironmentConfig) enabled(field string) bool {
+	for _, disabled := range ec.Disable {
+		if strings.EqualFold(disabled, field) {
+			return false
+		}
+	}
+	return true
+}
+
+type Environment struct {
+	OS             string
+	Distro         string
+	DistroID       string
+	Userland       string
+	Shell          string
+	Cwd            string
+	Root           bool
+	PackageManager string
+	Tools          []string
+
+	config EnvironmentConfig
+}
+
+// CollectEnvironment gathers the facts about the host enabled in cfg.
+func CollectEnvironment(cfg EnvironmentConfig) Environment {
+	env := Environment{
+		OS:     runtime.GOOS,
+		config: cfg,
+	}
+
+	osRelease := readOSRelease("/etc/os-release")
+	if runtime.GOOS == "darwin" {
+		env.Distro = macOSVersion()
+		env.DistroID = "macos"
+	} else {
+		env.Distro = osRelease["PRETTY_NAME"]
+		if env.Distro == "" {
+			env.Distro = strings.TrimSpace(osRelease["NAME"] + " " + osRelease["VERSION_ID"])
+		}
+		env.DistroID = osRelease["ID"]
+	}
+
+	env.Userland = detectUserland()
+	if shell := os.Getenv("SHELL"); shell != "" {
+		env.Shell = filepath.Base(shell)
+	}
+	if cwd, err := os.Getwd(); err == nil {
+		env.Cwd = cwd
+	}
+	env.Root = os.Geteuid() == 0
+	env.PackageManager = detectPackageManager(osRelease)
+
+	tools := cfg.Tools
+	if len(tools) == 0 {
+		tools = defaultEnvironmentTools
+	}
+	for _, tool := range tools {
+		if _, err := exec.LookPath(tool); err == nil {
+			env.Tools = append(env.Tools, tool)
+		}
+	}
+
+	return env
+}
+
+// OSName is the human readable platform name used in the prompt rules.
+func (e Environment) OSName() string {
+	switch e.OS {
+	case "darwin":
+		return "macOS"
+	case "linux":
+		return "Linux"
+	case "freebsd", "openbsd", "netbsd":
+		return strings.ToUpper(e.OS[:1]) + e.OS[1:]
+	default:
+		return e.OS
+	}
+}
+
+// String renders the enabled fields as a compact block for the prompt.
+func (e Environment) String() string {
+	var lines []string
+	if e.config.enabled(EnvFieldOS) {
+		system := e.OSName()
+		if e.config.enabled(EnvFieldDistro) && e.Distro != "" {
+			system += " (" + e.Distro + ")"
+		}
+		lines = append(lines, "OS: "+system)
+	} else if e.config.enabled(EnvFieldDistro) && e.Distro != "" {
+		lines = append(lines, "Distro: "+e.Distro)
+	}
+	if e.config.enabled(EnvFieldUserland) && e.Userland != "" {
+		lines = append(lines, "Userland: "+e.Userland)
+	}
+	if e.config.enabled(EnvFieldShell) && e.Shell != "" {
+		lines = append(lines, "Shell: "+e.Shell)
+	}
+	if e.config.enabled(EnvFieldCwd) && e.Cwd != "" {
+		lines = append(lines, "Cwd: "+e.Cwd)
+	}
+	if e.config.enabled(EnvFieldRoot) {
+		if e.Root {
+			lines = append(lines, "User: root")
+		} else {
+			lines = append(lines, "User: unprivileged (use sudo for system changes)")
+		}
+	}
+	if e.config.enabled(EnvFieldPackageManager) && e.PackageManager != "" {
+		lines = append(lines, "Package manager: "+e.PackageManager)
+	}
+	if e.config.enabled(EnvFieldTools) && len(e.Tools) > 0 {
+		lines = append(lines, "Available tools: "+strings.Join(e.Tools, ", "))
+	}
+	return strings.Join(lines, "\n")
+}
+
+func readOSRelease(path string) map[string]string {
+	values := make(map[string]string)
+	file, err := os.Open(path)
+	if err != nil {
+		return values
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			continue
+		}
+		values[key] = strings.Trim(value, `"'`)
+	}
+	return values
+}
+
+func macOSVersion() string {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	out, err := exec.CommandContext(ctx, "sw_vers", "-productVersion").Output()
+	if err != nil {
+		return "macOS"
+	}
+	return fmt.Sprintf("macOS %s", strings.TrimSpace(string(out)))
+}
+
+func detectUserland() string {
+	switch runtime.GOOS {
+	case "darwin", "freebsd", "openbsd", "netbsd":
+		return "BSD"
+	case "linux":
+		lsPath, err := exec.LookPath("ls")
+		if err != nil {
+			return ""
+		}
+		if resolved, err := filepath.EvalSymlinks(lsPath); err == nil && strings.Contains(filepath.Base(resolved), "busybox") {
+			return "BusyBox"
+		}
+		return "GNU"
+	default:
+		return ""
+	}
+}
+
+var packageManagersByDistro = map[string]string{
+	"debian":   "apt",
+	"ubuntu":   "apt",
+	"fedora":   "dnf",
+	"rhel":     "dnf",
+	"centos":   "dnf",
+	"arch":     "pacman",
+	"manjaro":  "pacman",
+	"alpine":   "apk",
+	"opensuse": "zypper",
+	"suse":     "zypper",
+	"void":     "xbps-install",
+	"gentoo":   "emerge",
+	"nixos":    "nix",
+}
+
+var packageManagerBinaries = []string{"apt", "dnf", "yum", "pacman", "apk", "zypper", "brew", "port", "pkg"}
+
+func detectPackageManager(osRelease map[string]string) string {
+	if runtime.GOOS == "darwin" {
+		if _, err := exec.LookPath("brew"); err == nil {
+			return "brew"
+		}
+		if _, err := exec.LookPath("port"); err == nil {
+			return "port"
+		}
+		return ""
+	}
+
+	ids := append([]string{osRelease["ID"]}, strings.Fields(osRelease["ID_LIKE"])...)
+	for _, id := range ids {
+		if manager, ok := packageManagersByDistro[id]; ok {
+			if _, err := exec.LookPath(manager); err == nil {
+				return manager
+			}
+		}
+	}
+	for _, manager := range packageManagerBinaries {
+		if _, err := exec.LookPath(manager); err == nil {
+			return manager
+		}
+	}
+	return ""
+}
@@ -0,0 +1,46 @@
+package model
+
+import (
+	"errors"
+	"io"
+	"os"
+	"os/exec"
+)
+
+// UserShell returns the user's login shell, falling back to /bin/sh.
+func UserShell() string {
+	if shell := os.Getenv("SHELL"); shell != "" {
+		if _, err := exec.LookPath(shell); err == nil {
+			return shell
+		}
+	}
+	return "/bin/sh"
+}
+
+// RunCommandLine executes line through the user's shell with the terminal
+// attached and returns the exit code.
+func RunCommandLine(line string) (int, error) {
+	return RunCommandLineCapturing(line, nil)
+}
+
+// RunCommandLineCapturing is RunCommandLine that also copies the command's
+// standard error to stderr, when it is not nil.
+func RunCommandLineCapturing(line string, stderr io.Writer) (int, error) {
+	cmd := exec.Command(UserShell(), "-c", line)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if stderr != nil {
+		cmd.Stderr = io.MultiWriter(os.Stderr, stderr)
+	}
+
+	err := cmd.Run()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return exitErr.ExitCode(), nil
+	}
+	if err != nil {
+		return -1, err
+	}
+	return 0, nil
+}
@@ -0,0 +1,211 @@
+package model
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	FEEDBACK_FILE_NAME   = "feedback.jsonl"
+	HISTORY_BASE_FOLDER  = "history"
+	maxFewShotExamples   = 2
+	maxFewShotCharacters = 600
+	// identicalQueryScore ranks an earlier answer to the same query above
+	// any keyword overlap, which is at most 1 plus the bonus for running.
+	identicalQueryScore = 2
+)
+
+type FeedbackKind string
+
+const (
+	FeedbackAccepted FeedbackKind = "accepted"
+	FeedbackRun      FeedbackKind = "run"
+	FeedbackRejected FeedbackKind = "rejected"
+)
+
+type Feedback struct {
+	Time   time.Time    `json:"time"`
+	Query  string       `json:"query"`
+	Kind   FeedbackKind `json:"kind"`
+	Result Result       `json:"result"`
+}
+
+func FeedbackPath() (string, error) {
+	appDataDir, err := AppDataDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(appDataDir, HISTORY_BASE_FOLDER, FEEDBACK_FILE_NAME), nil
+}
+
+// RecordFeedback appends the user's verdict on a suggestion to the feedback log.
+func RecordFeedback(query string, kind FeedbackKind, result Result) error {
+	feedbackPath, err := FeedbackPath()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(feedbackPath), 0700); err != nil {
+		return err
+	}
+	data, err := json.Marshal(Feedback{
+		Time:   time.Now(),
+		Query:  query,
+		Kind:   kind,
+		Result: result,
+	})
+	if err != nil {
+		return err
+	}
+	file, err := os.OpenFile(feedbackPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	_, err = file.Write(append(data, '\n'))
+	return err
+}
+
+func loadFeedback() ([]Feedback, error) {
+	feedbackPath, err := FeedbackPath()
+	if err != nil {
+		return nil, err
+	}
+	file, err := os.Open(feedbackPath)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var entries []Feedback
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var entry Feedback
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	return entries, scanner.Err()
+}
+
+// findFewShotExamples returns accepted query→command pairs from earlier
+// sessions, most similar to userInput first, ranked by keyword overlap.
+func findFewShotExamples(userInput string) []Feedback {
+	entries, err := loadFeedback()
+	if err != nil || len(entries) == 0 {
+		return nil
+	}
+
+	queryKeywords := extractKeywords(userInput)
+	if len(queryKeywords) == 0 {
+		return nil
+	}
+
+	// A later rejection of the same command for the same query cancels
+	// an earlier acceptance.
+	type pairKey struct{ query, command string }
+	latest := make(map[pairKey]Feedback)
+	var order []pairKey
+	for _, entry := range entries {
+		key := pairKey{entry.Query, entry.Result.CommandLine()}
+		if _, ok := latest[key]; !ok {
+			order = append(order, key)
+		}
+		latest[key] = entry
+	}
+
+	type scored struct {
+		entry Feedback
+		score float64
+	}
+	var candidates []scored
+	for _, key := range order {
+		entry := latest[key]
+		if entry.Kind == FeedbackRejected || hasRedactions(entry) {
+			continue
+		}
+		score := keywordOverlap(queryKeywords, extractKeywords(entry.Query))
+		if score == 0 {
+			continue
+		}
+		if sameQuery(entry.Query, userInput) {
+			// What was accepted for this very request is the best
+			// example there is.
+			score = identicalQueryScore
+		}
+		if entry.Kind == FeedbackRun {
+			score += 0.05
+		}
+		candidates = append(candidates, scored{entry: entry, score: score})
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		if candidates[i].score != candidates[j].score {
+			return candidates[i].score > candidates[j].score
+		}
+		return candidates[i].entry.Time.After(candidates[j].entry.Time)
+	})
+
+	var examples []Feedback
+	seenQueries := make(map[string]struct{})
+	totalChars := 0
+	for _, candidate := range candidates {
+		if len(examples) >= maxFewShotExamples {
+			break
+		}
+		if _, ok := seenQueries[candidate.entry.Query]; ok {
+			continue
+		}
+		size := len(candidate.entry.Query) + len(candidate.entry.Result.CommandLine()) + len(candidate.entry.Result.Explain)
+		if totalChars+size > maxFewShotCharacters {
+			continue
+		}
+		totalChars += size
+		seenQueries[candidate.entry.Query] = struct{}{}
+		examples = append(examples, candidate.entry)
+	}
+	return examples
+}
+
+// hasRedactions reports whether a secret was taken out of entry. Such an
+// entry makes a poor example, and one recorded with session tokens would
+// have them restored to the secrets of the current session.
+func hasRedactions(entry Feedback) bool {
+	text := entry.Query + " " + entry.Result.CommandLine()
+	return strings.Contains(text, redactedMarker) || strings.Contains(text, secretTokenPrefix)
+}
+
+// sameQuery reports whether two queries differ at most in case and
+// spacing.
+func sameQuery(a, b string) bool {
+	return strings.EqualFold(strings.Join(strings.Fields(a), " "), strings.Join(strings.Fields(b), " "))
+}
+
+// keywordOverlap is the Jaccard similarity of two keyword sets.
+func keywordOverlap(a, b []string) float64 {
+	if len(a) == 0 || len(b) == 0 {
+		return 0
+	}
+	set := make(map[string]struct{}, len(a))
+	for _, keyword := range a {
+		set[keyword] = struct{}{}
+	}
+	shared := 0
+	union := len(set)
+	for _, keyword := range b {
+		if _, ok := set[keyword]; ok {
+			shared++
+			continue
+		}
+		union++
+	}
+	return float64(shared) / float64(union)
+}
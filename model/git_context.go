@@ -0,0 +1,143 @@
+package model
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+const (
+	gitCommandTimeout = 2 * time.Second
+	maxRecentBranches = 8
+)
+
+// GitConfig controls the git repository context provider, which is on by
+// default and only consulted for git related queries.
+type GitConfig struct {
+	Disabled bool `yaml:"disabled,omitempty"`
+}
+
+var gitKeywords = map[string]struct{}{
+	"git": {}, "commit": {}, "commits": {}, "branch": {}, "branches": {},
+	"merge": {}, "merged": {}, "rebase": {}, "stash": {}, "push": {},
+	"pull": {}, "checkout": {}, "remote": {}, "remotes": {}, "upstream": {},
+	"tag": {}, "tags": {}, "cherry-pick": {}, "reset": {}, "revert": {},
+	"fetch": {}, "staged": {}, "unstaged": {}, "uncommitted": {},
+	"untracked": {}, "origin": {}, "head": {}, "blame": {}, "bisect": {},
+	"amend": {}, "squash": {}, "repo": {}, "repository": {},
+}
+
+// isGitTask reports whether the query keywords point at a git operation.
+func isGitTask(keywords []string) bool {
+	for _, keyword := range keywords {
+		if _, ok := gitKeywords[keyword]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// GitProvider describes the repository containing the working directory.
+type GitProvider struct {
+	dir string
+}
+
+func (gp GitProvider) Name() string {
+	return "Git repository"
+}
+
+func (gp GitProvider) Collect(userInput string, keywords []string) string {
+	if !isGitTask(keywords) {
+		return ""
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), gitCommandTimeout*3)
+	defer cancel()
+
+	if inside, err := gp.git(ctx, "rev-parse", "--is-inside-work-tree"); err != nil || inside != "true" {
+		return ""
+	}
+
+	var lines []string
+	if branch, err := gp.git(ctx, "rev-parse", "--abbrev-ref", "HEAD"); err == nil {
+		if branch == "HEAD" {
+			branch = "(detached HEAD)"
+		}
+		lines = append(lines, "Current branch: "+branch)
+	}
+	if upstream, err := gp.git(ctx, "rev-parse", "--abbrev-ref", "--symbolic-full-name", "@{u}"); err == nil && upstream != "" {
+		line := "Upstream: " + upstream
+		if counts, err := gp.git(ctx, "rev-list", "--left-right", "--count", "HEAD...@{u}"); err == nil {
+			if fields := strings.Fields(counts); len(fields) == 2 {
+				line += fmt.Sprintf(" (ahead %s, behind %s)", fields[0], fields[1])
+			}
+		}
+		lines = append(lines, line)
+	} else {
+		lines = append(lines, "Upstream: none")
+	}
+	if status, err := gp.git(ctx, "status", "--porcelain"); err == nil {
+		lines = append(lines, "Working tree: "+summarizeGitStatus(status))
+	}
+	if stashes, err := gp.git(ctx, "stash", "list"); err == nil {
+		lines = append(lines, fmt.Sprintf("Stash entries: %d", countLines(stashes)))
+	}
+	if remotes, err := gp.git(ctx, "remote"); err == nil && remotes != "" {
+		lines = append(lines, "Remotes: "+strings.Join(strings.Fields(remotes), ", "))
+	}
+	refFormat := "--format=%(refname:short)"
+	if branches, err := gp.git(ctx, "for-each-ref", "--sort=-committerdate", fmt.Sprintf("--count=%d", maxRecentBranches), refFormat, "refs/heads"); err == nil && branches != "" {
+		lines = append(lines, "Recent branches: "+strings.Join(strings.Fields(branches), ", "))
+	}
+	return strings.Join(lines, "\n")
+}
+
+func (gp GitProvider) git(ctx context.Context, args ...string) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, gitCommandTimeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Dir = gp.dir
+	cmd.Env = append(cmd.Environ(), "LANG=C", "GIT_OPTIONAL_LOCKS=0")
+	var stdout bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = io.Discard
+	if err := cmd.Run(); err != nil {
+		return "", err
+	}
+	// Only the final newline goes: the first line of status --porcelain
+	// starts with a space for a change that is not staged.
+	return strings.TrimRight(stdout.String(), "\n"), nil
+}
+
+func summarizeGitStatus(porcelain string) string {
+	if porcelain == "" {
+		return "clean"
+	}
+	staged, unstaged, untracked := 0, 0, 0
+	for _, line := range strings.Split(porcelain, "\n") {
+		if len(line) < 2 {
+			continue
+		}
+		if strings.HasPrefix(line, "??") {
+			untracked++
+			continue
+		}
+		if line[0] != ' ' {
+			staged++
+		}
+		if line[1] != ' ' {
+			unstaged++
+		}
+	}
+	return fmt.Sprintf("dirty (%d staged, %d unstaged, %d untracked)", staged, unstaged, untracked)
+}
+
+func countLines(text string) int {
+	if text == "" {
+		return 0
+	}
+	return strings.Count(text, "\n") + 1
+}
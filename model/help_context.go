@@ -0,0 +1,265 @@
+package model
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+const (
+	helpCommandTimeout = 2 * time.Second
+	maxHelpOutputBytes = 64 * 1024
+	minUsefulFlags     = 2
+)
+
+// ReferenceConfig controls how commands are picked for the reference
+// material and which sources that run programs may describe them.
+type ReferenceConfig struct {
+	NoHelpFlag bool                `yaml:"no_help_flag,omitempty"`
+	NoInfo     bool                `yaml:"no_info,omitempty"`
+	HelpDeny   []string            `yaml:"help_deny,omitempty"`
+	Intents    map[string][]string `yaml:"intents,omitempty"`
+}
+
+var shellBuiltins = map[string]struct{}{
+	"alias": {}, "bg": {}, "bind": {}, "builtin": {}, "cd": {}, "command": {},
+	"declare": {}, "dirs": {}, "disown": {}, "enable": {}, "eval": {},
+	"exec": {}, "exit": {}, "export": {}, "fc": {}, "fg": {}, "getopts": {},
+	"hash": {}, "history": {}, "jobs": {}, "let": {}, "local": {},
+	"mapfile": {}, "popd": {}, "pushd": {}, "read": {}, "readonly": {},
+	"return": {}, "set": {}, "shift": {}, "shopt": {}, "source": {},
+	"trap": {}, "type": {}, "typeset": {}, "ulimit": {}, "umask": {},
+	"unalias": {}, "unset": {}, "wait": {},
+}
+
+// helpDenyList holds programs that are never run with --help, because
+// some implementations ignore the flag and act immediately.
+var helpDenyList = map[string]struct{}{
+	"rm": {}, "dd": {}, "shred": {}, "mkfs": {}, "fdisk": {}, "sfdisk": {},
+	"parted": {}, "wipefs": {}, "shutdown": {}, "reboot": {}, "halt": {},
+	"poweroff": {}, "init": {}, "telinit": {}, "kill": {}, "killall": {},
+	"pkill": {}, "xkill": {}, "logout": {}, "sudo": {}, "su": {}, "doas": {},
+	"yes": {}, "sh": {}, "bash": {}, "zsh": {}, "fish": {}, "login": {},
+}
+
+func isShellBuiltin(name string) bool {
+	_, ok := shellBuiltins[name]
+	return ok
+}
+
+// hasCommandReference reports whether any reference source can describe
+// name: a man page, a shell builtin or, when help is set, a program on
+// PATH that can be run with --help.
+func hasCommandReference(ctx context.Context, index *ManIndex, name string, cfg ReferenceConfig, help bool) bool {
+	if _, ok := index.Lookup(name); ok {
+		return true
+	}
+	if !index.hasManPages() && hasManPage(ctx, name) {
+		return true
+	}
+	if isShellBuiltin(name) {
+		return true
+	}
+	if !help || cfg.NoHelpFlag || !helpAllowed(name, cfg) {
+		return false
+	}
+	_, err := exec.LookPath(name)
+	return err == nil
+}
+
+// fetchCommandReference picks the best documentation source for command:
+// bash's help for builtins, then the man page, then `command --help`, then
+// the info manual, depending on what is installed. --help is only run
+// when help is set.
+func fetchCommandReference(ctx context.Context, command string, keywords []string, tokenBudget int, cfg ReferenceConfig, help bool) (string, error) {
+	if isShellBuiltin(command) {
+		if text, err := fetchBuiltinHelp(ctx, command); err == nil {
+			return buildManExcerpt(command, text, keywords, tokenBudget), nil
+		}
+	}
+
+	manText, manErr := fetchManText(ctx, command)
+	if manErr == nil && !isInfoStub(manText) {
+		return buildManExcerpt(command, manText, keywords, tokenBudget), nil
+	}
+
+	if help && !cfg.NoHelpFlag && helpAllowed(command, cfg) {
+		if text, err := fetchHelpOutput(ctx, command); err == nil {
+			return buildManExcerpt(command, text, keywords, tokenBudget), nil
+		}
+	}
+	if !cfg.NoInfo {
+		if text, err := fetchInfoText(ctx, command); err == nil {
+			return buildManExcerpt(command, text, keywords, tokenBudget), nil
+		}
+	}
+	if manErr == nil {
+		return buildManExcerpt(command, manText, keywords, tokenBudget), nil
+	}
+	return "", fmt.Errorf("no reference found for %s", command)
+}
+
+func helpAllowed(name string, cfg ReferenceConfig) bool {
+	if _, denied := helpDenyList[name]; denied || strings.HasPrefix(name, "mkfs.") {
+		return false
+	}
+	for _, denied := range cfg.HelpDeny {
+		if denied == name {
+			return false
+		}
+	}
+	return true
+}
+
+// isInfoStub detects man pages that only point at the Texinfo manual.
+func isInfoStub(manText string) bool {
+	if len(parseManFlags(manText)) >= minUsefulFlags {
+		return false
+	}
+	lower := strings.ToLower(manText)
+	return strings.Contains(lower, "texinfo") || strings.Contains(lower, "info manual") ||
+		(strings.Contains(lower, "full documentation") && strings.Contains(lower, "info "))
+}
+
+func fetchBuiltinHelp(ctx context.Context, builtin string) (string, error) {
+	bash, err := exec.LookPath("bash")
+	if err != nil {
+		return "", err
+	}
+	// help -m prints the builtin in man page layout, which the flag parser
+	// and sliceManSections already understand.
+	text, err := runSandboxed(ctx, bash, "--norc", "--noprofile", "-c", "help -m "+builtin)
+	if err != nil {
+		return "", err
+	}
+	return strings.ReplaceAll(text, "\t", "    "), nil
+}
+
+func fetchHelpOutput(ctx context.Context, command string) (string, error) {
+	path, err := exec.LookPath(command)
+	if err != nil {
+		return "", err
+	}
+	text, err := runSandboxed(ctx, path, "--help")
+	if err != nil && text == "" {
+		return "", err
+	}
+	if !looksLikeHelp(text) {
+		return "", fmt.Errorf("%s --help printed no usage text", command)
+	}
+	return helpAsManText(text), nil
+}
+
+func fetchInfoText(ctx context.Context, command string) (string, error) {
+	info, err := exec.LookPath("info")
+	if err != nil {
+		return "", err
+	}
+	text, err := runSandboxed(ctx, info, "--output=-", command)
+	if err != nil {
+		return "", err
+	}
+	if strings.TrimSpace(text) == "" {
+		return "", fmt.Errorf("empty info page for %s", command)
+	}
+	return helpAsManText(text), nil
+}
+
+// runSandboxed runs a documentation command with no stdin, a minimal
+// environment, a timeout and a cap on the captured output.
+func runSandboxed(ctx context.Context, path string, args ...string) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, helpCommandTimeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, path, args...)
+	cmd.Env = []string{
+		"PATH=" + os.Getenv("PATH"),
+		"HOME=" + os.TempDir(),
+		"LANG=C",
+		"LC_ALL=C",
+		"TERM=dumb",
+		"NO_COLOR=1",
+		"PAGER=cat",
+		"MANPAGER=cat",
+	}
+	cmd.Dir = os.TempDir()
+	var output limitedBuffer
+	output.limit = maxHelpOutputBytes
+	cmd.Stdout = &output
+	cmd.Stderr = &output
+	cmd.WaitDelay = time.Second
+
+	err := cmd.Run()
+	text := stripOverstrike(output.String())
+	if ctx.Err() != nil {
+		return "", ctx.Err()
+	}
+	// Plenty of tools exit non-zero after printing usage, so the output is
+	// returned alongside the error for the caller to judge.
+	return text, err
+}
+
+type limitedBuffer struct {
+	bytes.Buffer
+	limit int
+}
+
+func (lb *limitedBuffer) Write(p []byte) (int, error) {
+	if remaining := lb.limit - lb.Len(); remaining > 0 {
+		if len(p) > remaining {
+			lb.Buffer.Write(p[:remaining])
+		} else {
+			lb.Buffer.Write(p)
+		}
+	}
+	return len(p), nil
+}
+
+func looksLikeHelp(text string) bool {
+	lower := strings.ToLower(text)
+	if strings.TrimSpace(lower) == "" {
+		return false
+	}
+	return strings.Contains(lower, "usage") || strings.Contains(lower, "options") ||
+		strings.Contains(lower, "flags") || strings.Contains(text, "\n  -")
+}
+
+// helpAsManText indents free-form help output so that its usage, options
+// and examples headings become man sections and option lines stay parsable.
+// Other headings stay in the text of the section they appear in.
+func helpAsManText(text string) string {
+	var builder strings.Builder
+	builder.WriteString("DESCRIPTION\n")
+	for _, line := range strings.Split(strings.ReplaceAll(text, "\t", "    "), "\n") {
+		trimmed := strings.TrimSpace(line)
+		if line == strings.TrimLeft(line, " ") && strings.HasSuffix(trimmed, ":") && len(trimmed) <= 30 {
+			if section := helpSectionName(strings.TrimSuffix(trimmed, ":")); section != "" {
+				builder.WriteString(section)
+				builder.WriteString("\n")
+				continue
+			}
+		}
+		builder.WriteString("    ")
+		builder.WriteString(line)
+		builder.WriteString("\n")
+	}
+	return builder.String()
+}
+
+func helpSectionName(heading string) string {
+	lower := strings.ToLower(heading)
+	switch {
+	case strings.Contains(lower, "usage"):
+		return "SYNOPSIS"
+	case strings.Contains(lower, "example"):
+		return "EXAMPLES"
+	case strings.Contains(lower, "option"), strings.Contains(lower, "flag"):
+		return "OPTIONS"
+	default:
+		return ""
+	}
+}
@@ -0,0 +1,220 @@
+package model
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// stopwords carry no hint about which command is wanted. Without them
+// "show me all files in src" would look up pages for show, all and in.
+var stopwords = map[string]struct{}{
+	"a": {}, "about": {}, "all": {}, "am": {}, "an": {}, "and": {}, "any": {},
+	"are": {}, "as": {}, "at": {}, "be": {}, "by": {}, "can": {}, "could": {},
+	"do": {}, "does": {}, "each": {}, "every": {}, "for": {}, "from": {},
+	"get": {}, "give": {}, "have": {}, "how": {}, "i": {}, "if": {}, "in": {},
+	"into": {}, "is": {}, "it": {}, "its": {}, "let": {}, "me": {}, "my": {},
+	"need": {}, "of": {}, "on": {}, "only": {}, "or": {}, "our": {},
+	"please": {}, "should": {}, "show": {}, "so": {}, "some": {}, "that": {},
+	"than": {}, "the": {}, "their": {}, "them": {}, "then": {}, "there": {}, "these": {},
+	"this": {}, "those": {}, "to": {}, "using": {}, "want": {}, "was": {},
+	"we": {}, "what": {}, "when": {}, "where": {}, "which": {}, "who": {},
+	"will": {}, "with": {}, "within": {}, "would": {}, "you": {}, "your": {},
+}
+
+// genericCommandWords are ordinary English words that happen to name a
+// command. They still count for search and intents, but mentioning one is
+// not taken as asking for that command.
+var genericCommandWords = map[string]struct{}{
+	"command": {}, "file": {}, "help": {}, "install": {}, "last": {},
+	"link": {}, "make": {}, "open": {}, "read": {}, "return": {},
+	"service": {}, "set": {}, "shift": {}, "source": {}, "test": {},
+	"time": {}, "type": {}, "wait": {}, "local": {}, "enable": {},
+	"exec": {}, "exit": {}, "hash": {}, "jobs": {}, "write": {},
+}
+
+// defaultIntents maps what people ask for to the tools that usually do it.
+// Keys are matched on stemmed words, so "compressed" and "compression" hit
+// "compress"; keys of several words need all of them in the query.
+var defaultIntents = map[string][]string{
+	"compress":       {"tar", "gzip", "zip"},
+	"archive":        {"tar", "zip"},
+	"extract":        {"tar", "unzip"},
+	"decompress":     {"tar", "gunzip", "unzip"},
+	"unzip":          {"unzip"},
+	"port":           {"ss", "lsof"},
+	"listen":         {"ss", "lsof"},
+	"disk usage":     {"du", "df"},
+	"disk space":     {"df", "du"},
+	"free space":     {"df"},
+	"file size":      {"find", "du"},
+	"bigger":         {"find"},
+	"larger":         {"find"},
+	"largest":        {"du", "sort"},
+	"limit":          {"ulimit"},
+	"folder size":    {"du"},
+	"directory size": {"du"},
+	"memory":         {"free", "ps"},
+	"cpu":            {"top", "ps"},
+	"process":        {"ps", "pgrep"},
+	"kill":           {"kill", "pkill"},
+	"download":       {"curl", "wget"},
+	"http request":   {"curl"},
+	"search text":    {"grep"},
+	"search file":    {"find", "grep"},
+	"find file":      {"find"},
+	"replace":        {"sed"},
+	"permission":     {"chmod", "chown"},
+	"owner":          {"chown"},
+	"schedule":       {"crontab"},
+	"cron":           {"crontab"},
+	"log":            {"journalctl", "tail"},
+	"ip address":     {"ip", "ifconfig"},
+	"dns":            {"dig", "nslookup"},
+	"copy remote":    {"scp", "rsync"},
+	"sync":           {"rsync"},
+	"mount":          {"mount", "lsblk"},
+	"partition":      {"lsblk"},
+	"count line":     {"wc"},
+	"duplicate":      {"sort", "uniq"},
+	"symlink":        {"ln"},
+	"rename":         {"mv"},
+	"checksum":       {"sha256sum", "md5sum"},
+	"encrypt":        {"gpg", "openssl"},
+	"certificate":    {"openssl"},
+	"uptime":         {"uptime"},
+}
+
+// extractKeywords lowercases input and splits it into words, keeping
+// dashes and underscores so that flags and names like git-log survive.
+// Stopwords and repeats are dropped.
+func extractKeywords(input string) []string {
+	fields := strings.FieldsFunc(strings.ToLower(input), func(r rune) bool {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return false
+		}
+		switch r {
+		case '-', '_':
+			return false
+		default:
+			return true
+		}
+	})
+	seen := make(map[string]struct{})
+	var keywords []string
+	for _, field := range fields {
+		if len(field) == 0 {
+			continue
+		}
+		if _, ok := stopwords[field]; ok {
+			continue
+		}
+		if _, ok := seen[field]; ok {
+			continue
+		}
+		seen[field] = struct{}{}
+		keywords = append(keywords, field)
+	}
+	return keywords
+}
+
+// stemSuffixes are stripped in order by stemWord; the first that leaves a
+// stem of at least three letters wins.
+var stemSuffixes = []string{"ations", "ation", "ions", "ion", "ings", "ing", "edly", "ed", "ers", "er", "es", "s", "e"}
+
+// stemWord is a deliberately light stemmer, enough to make "compressed",
+// "compression" and "compresses" meet at "compress".
+func stemWord(word string) string {
+	if len(word) <= 3 || strings.ContainsAny(word, "0123456789") {
+		return word
+	}
+	for _, suffix := range stemSuffixes {
+		if !strings.HasSuffix(word, suffix) {
+			continue
+		}
+		if suffix == "s" && strings.HasSuffix(word, "ss") {
+			continue
+		}
+		if stem := strings.TrimSuffix(word, suffix); len(stem) >= 3 {
+			return stem
+		}
+	}
+	return word
+}
+
+func isGenericCommandWord(word string) bool {
+	_, ok := genericCommandWords[word]
+	return ok
+}
+
+type intent struct {
+	stems []string
+	tools []string
+}
+
+// buildIntents merges the user's intents from config over the built-in
+// table; a user key replaces the built-in tools for the same key.
+func buildIntents(extra map[string][]string) []intent {
+	merged := make(map[string][]string, len(defaultIntents)+len(extra))
+	for phrase, tools := range defaultIntents {
+		merged[intentKey(phrase)] = tools
+	}
+	for phrase, tools := range extra {
+		merged[intentKey(phrase)] = tools
+	}
+
+	intents := make([]intent, 0, len(merged))
+	for key, tools := range merged {
+		if key == "" {
+			continue
+		}
+		intents = append(intents, intent{stems: strings.Fields(key), tools: tools})
+	}
+	// More specific phrases first, then alphabetical for a stable order.
+	sort.Slice(intents, func(i, j int) bool {
+		if len(intents[i].stems) != len(intents[j].stems) {
+			return len(intents[i].stems) > len(intents[j].stems)
+		}
+		return strings.Join(intents[i].stems, " ") < strings.Join(intents[j].stems, " ")
+	})
+	return intents
+}
+
+func intentKey(phrase string) string {
+	var stems []string
+	for _, word := range extractKeywords(phrase) {
+		stems = append(stems, stemWord(word))
+	}
+	return strings.Join(stems, " ")
+}
+
+// matchIntents returns the tools suggested by the intents whose words all
+// appear in keywords, in table order and without repeats.
+func matchIntents(intents []intent, keywords []string) []string {
+	stems := make(map[string]struct{}, len(keywords))
+	for _, keyword := range keywords {
+		stems[stemWord(keyword)] = struct{}{}
+	}
+	var tools []string
+	seen := make(map[string]struct{})
+	for _, in := range intents {
+		matched := true
+		for _, stem := range in.stems {
+			if _, ok := stems[stem]; !ok {
+				matched = false
+				break
+			}
+		}
+		if !matched {
+			continue
+		}
+		for _, tool := range in.tools {
+			if _, ok := seen[tool]; ok {
+				continue
+			}
+			seen[tool] = struct{}{}
+			tools = append(tools, tool)
+		}
+	}
+	return tools
+}
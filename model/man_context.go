@@ -7,99 +7,153 @@ import (
 	"io"
 	"os/exec"
 	"strings"
+	"sync"
 	"time"
 	"unicode"
 )
 
 const (
-	maxReferenceCommands   = 2
-	maxReferenceCharacters = 2000
-	manCommandTimeout      = 5 * time.Second
+	maxReferenceCommands = 2
+	maxReferenceTokens   = 500
+	manCommandTimeout    = 5 * time.Second
 )
 
-func buildManReference(userInput string) string {
-	ctx, cancel := context.WithTimeout(context.Background(), manCommandTimeout)
-	defer cancel()
+// Reference is the documentation sent along with a query: excerpts from
+// man pages and similar system sources, and entries from the team catalog.
+type Reference struct {
+	Man     string
+	Catalog string
+}
 
+func buildManReference(ctx context.Context, userInput string, indexConfig IndexConfig, referenceConfig ReferenceConfig) Reference {
 	keywords := extractKeywords(userInput)
 	if len(keywords) == 0 {
-		return ""
+		return Reference{}
 	}
 
-	commandCandidates := selectCommandCandidates(ctx, keywords)
+	// Without an index of the man pages (unwritable cache, no man
+	// directories) candidate selection falls back to per-keyword lookups
+	// and the catalogs are read directly.
+	index := loadReferenceIndex(ctx, indexConfig)
+
+	ctx, cancel := context.WithTimeout(ctx, manCommandTimeout)
+	defer cancel()
+
+	commandCandidates := selectCommandCandidates(ctx, index, keywords, referenceConfig)
 	if len(commandCandidates) == 0 {
-		return ""
+		return Reference{}
 	}
 
-	var snippets []string
-	totalChars := 0
-	for _, cmdName := range commandCandidates {
-		excerpt, err := fetchManExcerpt(ctx, cmdName)
-		if err != nil || excerpt == "" {
+	var manSnippets, catalogSnippets []string
+	remaining := maxReferenceTokens
+	for i, candidate := range commandCandidates {
+		cmdName := candidate.name
+		// Split what is left evenly, so a short first page leaves more
+		// room for the next one.
+		header := fmt.Sprintf("COMMAND: %s\n", cmdName)
+		budget := remaining/(len(commandCandidates)-i) - estimateTokens(header)
+		doc, indexed := index.Lookup(cmdName)
+		if indexed && doc.CatalogPath != "" {
+			entry, err := readCatalogEntry(doc.CatalogPath, doc.Name)
+			if err != nil {
+				continue
+			}
+			section := header + buildManExcerpt(doc.Name, entry.ManText(), keywords, budget)
+			catalogSnippets = append(catalogSnippets, section)
+			remaining -= estimateTokens(section)
 			continue
 		}
-		section := fmt.Sprintf("COMMAND: %s\n%s", cmdName, excerpt)
-		snippets = append(snippets, section)
-		totalChars += len(section)
-		if totalChars >= maxReferenceCharacters {
+
+		excerpt, err := fetchCommandReference(ctx, cmdName, keywords, budget, referenceConfig, candidate.help)
+		if err != nil || excerpt == "" {
+			if !indexed || doc.TldrPath == "" {
+				continue
+			}
+			if excerpt, err = readTldrPage(doc.TldrPath); err != nil {
+				continue
+			}
+			excerpt = truncateToTokens(excerpt, budget)
+		}
+		section := header + excerpt
+		manSnippets = append(manSnippets, section)
+		remaining -= estimateTokens(section)
+		if remaining <= 0 {
 			break
 		}
 	}
 
-	return strings.TrimSpace(strings.Join(snippets, "\n\n"))
+	// Sections are budgeted one by one; what counts is the whole.
+	reference := Reference{
+		Man:     strings.TrimSpace(strings.Join(manSnippets, "\n\n")),
+		Catalog: strings.TrimSpace(strings.Join(catalogSnippets, "\n\n")),
+	}
+	reference.Catalog = truncateToTokens(reference.Catalog, maxReferenceTokens)
+	reference.Man = truncateToTokens(reference.Man, maxReferenceTokens-estimateTokens(reference.Catalog))
+	return reference
 }
 
-func extractKeywords(input string) []string {
-	fields := strings.FieldsFunc(strings.ToLower(input), func(r rune) bool {
-		if unicode.IsLetter(r) || unicode.IsDigit(r) {
-			return false
-		}
-		switch r {
-		case '-', '_':
-			return false
-		default:
-			return true
-		}
-	})
-	seen := make(map[string]struct{})
-	var keywords []string
-	for _, field := range fields {
-		if len(field) == 0 {
-			continue
-		}
-		if _, ok := seen[field]; ok {
-			continue
-		}
-		seen[field] = struct{}{}
-		keywords = append(keywords, field)
-	}
-	return keywords
+// commandCandidate is a command picked for the reference material.
+type commandCandidate struct {
+	name string
+	// help is set when the command may be run with --help. Words of the
+	// query are not: "kill the process" must not run kill --help just
+	// because kill is on PATH, so those need a man page or builtin help.
+	help bool
 }
 
-func selectCommandCandidates(ctx context.Context, keywords []string) []string {
-	var candidates []string
+func selectCommandCandidates(ctx context.Context, index *ManIndex, keywords []string, referenceConfig ReferenceConfig) []commandCandidate {
+	var candidates []commandCandidate
 	seen := make(map[string]struct{})
 
 	for _, token := range keywords {
 		if len(candidates) >= maxReferenceCommands {
 			break
 		}
-		if !isLikelyCommand(token) {
+		if !isLikelyCommand(token) || isGenericCommandWord(token) {
 			continue
 		}
 		if _, ok := seen[token]; ok {
 			continue
 		}
-		if hasManPage(ctx, token) {
-			candidates = append(candidates, token)
+		if hasCommandReference(ctx, index, token, referenceConfig, false) {
+			candidates = append(candidates, commandCandidate{name: token})
 			seen[token] = struct{}{}
 		}
 	}
 
+	for _, tool := range matchIntents(buildIntents(referenceConfig.Intents), keywords) {
+		if len(candidates) >= maxReferenceCommands {
+			return candidates
+		}
+		if _, ok := seen[tool]; ok {
+			continue
+		}
+		if hasCommandReference(ctx, index, tool, referenceConfig, true) {
+			candidates = append(candidates, commandCandidate{name: tool, help: true})
+			seen[tool] = struct{}{}
+		}
+	}
+
 	if len(candidates) >= maxReferenceCommands {
 		return candidates
 	}
 
+	if index != nil {
+		for _, match := range index.Search(keywords, maxReferenceCommands+len(candidates)) {
+			if len(candidates) >= maxReferenceCommands {
+				break
+			}
+			if _, ok := seen[match]; ok {
+				continue
+			}
+			candidates = append(candidates, commandCandidate{name: match, help: true})
+			seen[match] = struct{}{}
+		}
+		if index.hasManPages() {
+			return candidates
+		}
+	}
+
 	for _, token := range keywords {
 		if len(candidates) >= maxReferenceCommands {
 			break
@@ -108,7 +162,7 @@ func selectCommandCandidates(ctx context.Context, keywords []string) []string {
 			if _, ok := seen[match]; ok {
 				continue
 			}
-			candidates = append(candidates, match)
+			candidates = append(candidates, commandCandidate{name: match, help: true})
 			seen[match] = struct{}{}
 			if len(candidates) >= maxReferenceCommands {
 				break
@@ -132,30 +186,59 @@ func isLikelyCommand(token string) bool {
 }
 
 func hasManPage(ctx context.Context, topic string) bool {
+	if findManPage(topic) != "" {
+		return true
+	}
+	if _, err := exec.LookPath("man"); err != nil {
+		return false
+	}
 	cmd := exec.CommandContext(ctx, "man", "-w", topic)
 	cmd.Stdout = io.Discard
 	cmd.Stderr = io.Discard
 	return cmd.Run() == nil
 }
 
-func fetchManExcerpt(ctx context.Context, command string) (string, error) {
-	shellCmd := fmt.Sprintf("LANG=C man %s | col -bx", shellEscape(command))
-	cmd := exec.CommandContext(ctx, "/bin/bash", "-lc", shellCmd)
+func fetchManText(ctx context.Context, command string) (string, error) {
+	if text, err := readManPage(command); err == nil {
+		return text, nil
+	}
+	if _, err := exec.LookPath("man"); err != nil {
+		return "", fmt.Errorf("no man page for %s", command)
+	}
+
+	// Fall back to man for pages we cannot locate or parse ourselves.
+	cmd := exec.CommandContext(ctx, "man", command)
+	cmd.Env = append(cmd.Environ(), "LANG=C", "MANWIDTH=80", "MANPAGER=cat", "PAGER=cat")
 	var stdout bytes.Buffer
 	cmd.Stdout = &stdout
 	cmd.Stderr = io.Discard
 	if err := cmd.Run(); err != nil {
 		return "", err
 	}
-	return sliceManSections(stdout.String()), nil
+	return stripOverstrike(stdout.String()), nil
 }
 
+var (
+	manEntriesOnce sync.Once
+	manEntries     []ManEntry
+)
+
 func searchApropos(ctx context.Context, keyword string, limit int) []string {
 	if limit <= 0 || len(keyword) == 0 {
 		return nil
 	}
-	shellCmd := fmt.Sprintf("LANG=C man -k %s", shellEscape(keyword))
-	cmd := exec.CommandContext(ctx, "/bin/bash", "-lc", shellCmd)
+	manEntriesOnce.Do(func() {
+		manEntries = scanManEntries(ctx)
+	})
+	if len(manEntries) > 0 {
+		return searchManEntries(manEntries, keyword, limit)
+	}
+
+	if _, err := exec.LookPath("man"); err != nil {
+		return nil
+	}
+	cmd := exec.CommandContext(ctx, "man", "-k", keyword)
+	cmd.Env = append(cmd.Environ(), "LANG=C")
 	var stdout bytes.Buffer
 	cmd.Stdout = &stdout
 	cmd.Stderr = io.Discard
@@ -190,7 +273,7 @@ func parseAproposLine(line string) string {
 	return strings.TrimSpace(line[:idx])
 }
 
-func sliceManSections(manText string) string {
+func sliceManSections(manText string, tokenBudget int) string {
 	lines := strings.Split(manText, "\n")
 	if len(lines) == 0 {
 		return ""
@@ -218,7 +301,9 @@ func sliceManSections(manText string) string {
 			continue
 		}
 
-		if isSectionHeader(trimmed) {
+		// Headers start in the first column; indented capitals are
+		// option tags such as "-C".
+		if line == strings.TrimLeft(line, " \t") && isSectionHeader(trimmed) {
 			if _, ok := allowedSections[trimmed]; ok {
 				if builder.Len() > 0 {
 					builder.WriteString("\n")
@@ -238,21 +323,21 @@ func sliceManSections(manText string) string {
 		if currentSection != "" {
 			builder.WriteString(line)
 			builder.WriteString("\n")
-			if builder.Len() >= maxReferenceCharacters {
+			if estimateTokens(builder.String()) >= tokenBudget {
 				break
 			}
 		}
 	}
 
 	if builder.Len() == 0 {
-		fallback := fallbackExcerpt(lines)
+		fallback := fallbackExcerpt(lines, tokenBudget)
 		builder.WriteString(fallback)
 	}
 
 	return strings.TrimSpace(builder.String())
 }
 
-func fallbackExcerpt(lines []string) string {
+func fallbackExcerpt(lines []string, tokenBudget int) string {
 	var builder strings.Builder
 	for _, line := range lines {
 		trimmed := strings.TrimSpace(line)
@@ -261,7 +346,7 @@ func fallbackExcerpt(lines []string) string {
 		}
 		builder.WriteString(line)
 		builder.WriteString("\n")
-		if builder.Len() >= maxReferenceCharacters {
+		if estimateTokens(builder.String()) >= tokenBudget {
 			break
 		}
 	}
@@ -290,10 +375,3 @@ func isSectionHeader(line string) bool {
 	}
 	return true
 }
-
-func shellEscape(value string) string {
-	if value == "" {
-		return "''"
-	}
-	return "'" + strings.ReplaceAll(value, "'", "'\\''") + "'"
-}
@@ -0,0 +1,352 @@
+package model
+
+import (
+	"math"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+)
+
+const (
+	maxFlagBodyCharacters = 320
+	minFallbackFlags      = 4
+)
+
+// ManFlag is one option entry parsed from a rendered man page: the tag line
+// ("-r, --recursive") and its description.
+type ManFlag struct {
+	Tag  string
+	Body string
+}
+
+// Names returns the flags spelled in the tag, e.g. ["-r", "--recursive"].
+func (f ManFlag) Names() []string {
+	var names []string
+	for _, field := range strings.FieldsFunc(f.Tag, func(r rune) bool {
+		return r == ',' || r == ' ' || r == '|' || r == '[' || r == ']'
+	}) {
+		if !strings.HasPrefix(field, "-") || field == "-" || field == "--" {
+			continue
+		}
+		if idx := strings.IndexAny(field, "=["); idx > 0 {
+			field = field[:idx]
+		}
+		names = append(names, field)
+	}
+	return names
+}
+
+func (f ManFlag) String() string {
+	if f.Body == "" {
+		return "  " + f.Tag
+	}
+	return "  " + f.Tag + "\n      " + f.Body
+}
+
+// parseManFlags collects every option entry in the rendered page. GNU pages
+// list options under DESCRIPTION, find under TESTS and ACTIONS, so all
+// sections are scanned. An entry is a line starting with "-" whose
+// description is indented further, or follows on the same line after a gap.
+func parseManFlags(manText string) []ManFlag {
+	lines := strings.Split(manText, "\n")
+	var flags []ManFlag
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		trimmed := strings.TrimSpace(line)
+		if !strings.HasPrefix(trimmed, "-") || len(trimmed) < 2 || trimmed[1] == ' ' {
+			continue
+		}
+		indent := len(line) - len(strings.TrimLeft(line, " "))
+		if indent == 0 {
+			continue
+		}
+
+		tag, body := trimmed, ""
+		if idx := strings.Index(trimmed, "   "); idx > 0 {
+			tag, body = trimmed[:idx], strings.TrimSpace(trimmed[idx:])
+		}
+
+		var bodyLines []string
+		if body != "" {
+			bodyLines = append(bodyLines, body)
+		}
+		j := i + 1
+		for ; j < len(lines); j++ {
+			next := lines[j]
+			nextTrimmed := strings.TrimSpace(next)
+			if nextTrimmed == "" {
+				// A blank line ends the entry unless the description
+				// continues at the same deeper indent.
+				if j+1 < len(lines) && indentOf(lines[j+1]) > indent && !strings.HasPrefix(strings.TrimSpace(lines[j+1]), "-") {
+					continue
+				}
+				break
+			}
+			if indentOf(next) <= indent {
+				break
+			}
+			bodyLines = append(bodyLines, nextTrimmed)
+		}
+		if len(bodyLines) == 0 {
+			continue
+		}
+		i = j - 1
+
+		body = strings.Join(strings.Fields(strings.Join(bodyLines, " ")), " ")
+		if len(body) > maxFlagBodyCharacters {
+			body = strings.TrimSpace(body[:maxFlagBodyCharacters]) + "..."
+		}
+		flags = append(flags, ManFlag{Tag: tag, Body: body})
+	}
+	return flags
+}
+
+func indentOf(line string) int {
+	return len(line) - len(strings.TrimLeft(line, " "))
+}
+
+// flagSynonyms map query words, by stem, to the words option descriptions
+// use for the same thing: "bigger than 100MB" is about find's -size.
+var flagSynonyms = stemKeys(map[string][]string{
+	"bigger": {"size"}, "larger": {"size"}, "smaller": {"size"}, "size": {"size"},
+	"older": {"modified", "time"}, "newer": {"modified", "time"}, "modified": {"modified", "time"},
+	"days": {"modified", "time"}, "hours": {"modified", "time"}, "recent": {"modified", "time"},
+	"newest": {"time", "sort"}, "latest": {"time", "sort"}, "oldest": {"time", "sort"},
+	"hidden": {"all", "hidden"}, "dotfiles": {"all", "hidden"},
+	"recursive": {"recursive", "recursively"}, "subdirectories": {"recursive", "recursively"},
+	"insensitive": {"ignore", "case"}, "case": {"ignore", "case"},
+	"readable": {"human"}, "human": {"human"},
+	"owner": {"user", "owner"}, "owned": {"user", "owner"},
+	"permissions": {"permission", "perm", "mode"}, "executable": {"permission", "perm", "mode"},
+	"symlinks": {"follow", "symbolic"}, "follow": {"follow", "symbolic"},
+	"exclude": {"exclude"}, "excluding": {"exclude"}, "except": {"exclude"},
+	"count": {"count"}, "sorted": {"sort"}, "reverse": {"reverse"},
+	"quiet": {"quiet", "silent"}, "silent": {"quiet", "silent"}, "verbose": {"verbose"},
+	"delete": {"delete", "remove"}, "remove": {"delete", "remove"}, "empty": {"empty"},
+})
+
+// genericWords, by stem, are in nearly every page summary and option
+// description, so they tell none apart.
+var genericWords = stemKeys(map[string][]string{
+	"file": nil, "files": nil, "directory": nil, "directories": nil, "folder": nil,
+	"dir": nil, "command": nil, "use": nil,
+})
+
+// sizePattern matches sizes written in a query, such as 100mb or 2g.
+var sizePattern = regexp.MustCompile(`^\d+(\.\d+)?[kmgt]i?b?$`)
+
+func stemKeys(words map[string][]string) map[string][]string {
+	stems := make(map[string][]string, len(words))
+	for word, terms := range words {
+		stems[stemWord(word)] = terms
+	}
+	return stems
+}
+
+// flagKeywords turns the query keywords into the terms options of command
+// are scored by: the command's own name and words every option uses are
+// dropped, and words are joined by the ones descriptions use instead.
+func flagKeywords(command string, keywords []string) []string {
+	name := filepath.Base(command)
+	var terms []string
+	for _, keyword := range keywords {
+		if keyword == name {
+			continue
+		}
+		stem := stemWord(keyword)
+		if _, generic := genericWords[stem]; !generic {
+			terms = append(terms, keyword)
+		}
+		terms = append(terms, flagSynonyms[stem]...)
+		if sizePattern.MatchString(keyword) {
+			terms = append(terms, "size")
+		}
+	}
+	return terms
+}
+
+type scoredFlag struct {
+	flag  ManFlag
+	score float64
+	order int
+}
+
+// scoreManFlags rates each flag by the query terms its tag and description
+// mention, weighted by how rare the term is among the page's flags so that
+// words every entry uses count for little. Tag hits count double and a flag
+// spelled in the query itself wins outright.
+func scoreManFlags(flags []ManFlag, keywords []string) []scoredFlag {
+	queryTerms := make(map[string]struct{})
+	literal := make(map[string]struct{})
+	for _, keyword := range keywords {
+		if strings.HasPrefix(keyword, "-") {
+			literal[keyword] = struct{}{}
+		}
+		for _, term := range indexTerms(keyword) {
+			queryTerms[term] = struct{}{}
+		}
+	}
+
+	tagTerms := make([]map[string]struct{}, len(flags))
+	bodyTerms := make([]map[string]struct{}, len(flags))
+	docFreq := make(map[string]int)
+	for i, flag := range flags {
+		tagTerms[i] = termSet(flag.Tag)
+		bodyTerms[i] = termSet(flag.Body)
+		for term := range queryTerms {
+			_, inTag := tagTerms[i][term]
+			_, inBody := bodyTerms[i][term]
+			if inTag || inBody {
+				docFreq[term]++
+			}
+		}
+	}
+
+	scored := make([]scoredFlag, 0, len(flags))
+	for i, flag := range flags {
+		score := 0.0
+		for _, name := range flag.Names() {
+			if _, ok := literal[strings.ToLower(name)]; ok {
+				score += 10
+			}
+		}
+		for term := range queryTerms {
+			weight := math.Log(1 + float64(len(flags))/float64(max(docFreq[term], 1)))
+			if _, ok := tagTerms[i][term]; ok {
+				score += 2 * weight
+			}
+			if _, ok := bodyTerms[i][term]; ok {
+				score += weight
+			}
+		}
+		scored = append(scored, scoredFlag{flag: flag, score: score, order: i})
+	}
+	sort.SliceStable(scored, func(i, j int) bool { return scored[i].score > scored[j].score })
+	return scored
+}
+
+func termSet(text string) map[string]struct{} {
+	set := make(map[string]struct{})
+	for _, word := range extractKeywords(text) {
+		for _, term := range indexTerms(word) {
+			set[term] = struct{}{}
+		}
+	}
+	return set
+}
+
+// buildManExcerpt assembles the reference for command within tokenBudget:
+// the synopsis, the flags that best match the query and the examples.
+// Pages without parsable options fall back to sliceManSections.
+func buildManExcerpt(command, manText string, keywords []string, tokenBudget int) string {
+	sections := splitManSections(manText)
+	flags := parseManFlags(manText)
+	examples := sections["EXAMPLES"]
+	if examples == "" {
+		examples = sections["EXAMPLE"]
+	}
+	if len(flags) == 0 && examples == "" {
+		return sliceManSections(manText, tokenBudget)
+	}
+
+	var builder strings.Builder
+	remaining := tokenBudget
+	write := func(text string) bool {
+		cost := estimateTokens(text)
+		if cost > remaining {
+			return false
+		}
+		builder.WriteString(text)
+		remaining -= cost
+		return true
+	}
+
+	if name := compactLines(sections["NAME"]); name != "" {
+		write("NAME\n" + name + "\n")
+	}
+	if synopsis := compactLines(sections["SYNOPSIS"]); synopsis != "" {
+		write("SYNOPSIS\n" + truncateToTokens(synopsis, tokenBudget/4) + "\n")
+	}
+
+	// Examples are the most directly useful text, so reserve up to a
+	// quarter of the budget for them before spending the rest on flags.
+	exampleText := ""
+	if examples != "" {
+		exampleText = "EXAMPLES\n" + truncateToTokens(compactLines(examples), tokenBudget/4) + "\n"
+	}
+	remaining -= estimateTokens(exampleText)
+
+	scored := scoreManFlags(flags, flagKeywords(command, keywords))
+	var chosen []scoredFlag
+	for _, candidate := range scored {
+		// Without any match a few leading options still show the
+		// general shape of the command.
+		if candidate.score <= 0 && (scored[0].score > 0 || len(chosen) >= minFallbackFlags) {
+			break
+		}
+		if estimateTokens(candidate.flag.String())+1 > remaining {
+			continue
+		}
+		chosen = append(chosen, candidate)
+		remaining -= estimateTokens(candidate.flag.String()) + 1
+	}
+	remaining += estimateTokens(exampleText)
+
+	head := builder.String()
+	assemble := func() string {
+		var excerpt strings.Builder
+		excerpt.WriteString(head)
+		// Present the chosen flags in page order, which groups related
+		// ones.
+		ordered := slices.Clone(chosen)
+		sort.SliceStable(ordered, func(i, j int) bool { return ordered[i].order < ordered[j].order })
+		if len(ordered) > 0 {
+			excerpt.WriteString("OPTIONS\n")
+			for _, candidate := range ordered {
+				excerpt.WriteString(candidate.flag.String())
+				excerpt.WriteString("\n")
+			}
+		}
+		if exampleText != "" && estimateTokens(exampleText) <= remaining {
+			excerpt.WriteString(exampleText)
+		}
+		return strings.TrimSpace(excerpt.String())
+	}
+	// The estimates of the parts do not quite add up to that of the
+	// whole, so the least relevant flags go until the excerpt fits.
+	excerpt := assemble()
+	for estimateTokens(excerpt) > tokenBudget && len(chosen) > 0 {
+		chosen = chosen[:len(chosen)-1]
+		excerpt = assemble()
+	}
+	return truncateToTokens(excerpt, tokenBudget)
+}
+
+// compactLines drops blank lines and common indentation.
+func compactLines(text string) string {
+	var lines []string
+	for _, line := range strings.Split(text, "\n") {
+		if trimmed := strings.TrimSpace(line); trimmed != "" {
+			lines = append(lines, "  "+trimmed)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// truncateToTokens cuts text at a line boundary so it fits in tokens.
+func truncateToTokens(text string, tokens int) string {
+	if estimateTokens(text) <= tokens {
+		return text
+	}
+	var builder strings.Builder
+	for _, line := range strings.Split(text, "\n") {
+		if estimateTokens(builder.String()+line) > tokens {
+			break
+		}
+		builder.WriteString(line)
+		builder.WriteString("\n")
+	}
+	return strings.TrimRight(builder.String(), "\n")
+}
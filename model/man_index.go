@@ -0,0 +1,758 @@
+package model
+
+import (
+	"bufio"
+	"context"
+	"encoding/gob"
+	"fmt"
+	"math"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+)
+
+const (
+	MAN_INDEX_FILE_NAME      = "man-index.gob"
+	manIndexVersion          = 5
+	maxIndexedDescription    = 1500
+	bm25K1                   = 1.2
+	bm25B                    = 0.5
+	manIndexNameWeight       = 4
+	manIndexSummaryWeight    = 3
+	manIndexSynopsisWeight   = 1
+	manIndexSearchCandidates = 20
+	// manIndexMinRelativeScore drops matches scoring less than this share
+	// of the best one; they matched a stray word of the query.
+	manIndexMinRelativeScore = 0.5
+)
+
+// IndexConfig controls what goes into the man page search index.
+type IndexConfig struct {
+	Tldr     bool     `yaml:"tldr,omitempty"`
+	TldrDirs []string `yaml:"tldr_dirs,omitempty"`
+	Catalogs []string `yaml:"catalogs,omitempty"`
+}
+
+var defaultTldrDirs = []string{
+	"~/.cache/tldr/pages",
+	"~/.local/share/tldr/pages",
+	"~/.tldrc/tldr/pages",
+	"~/.tldr/cache/pages",
+	"~/Library/Caches/tldr/pages",
+}
+
+type ManIndex struct {
+	Version int
+	// Dirs fingerprints every scanned directory so that only changed
+	// directories are rescanned.
+	Dirs     map[string]dirFingerprint
+	Docs     []ManIndexDoc
+	Aliases  map[string]string
+	DocFreq  map[string]int
+	AvgTerms float64
+
+	byName map[string]int
+	// catalogOnly is set for an index of the catalogs alone, read when
+	// the cached index is unavailable.
+	catalogOnly bool
+}
+
+type dirFingerprint struct {
+	ModTime int64
+	Entries int
+}
+
+type ManIndexDoc struct {
+	Name        string
+	Section     string
+	Path        string
+	TldrPath    string
+	CatalogPath string
+	Description string
+	ModTime     int64
+	Terms       map[string]int
+	Length      int
+}
+
+func ManIndexPath() (string, error) {
+	cacheDir, err := CacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(cacheDir, MAN_INDEX_FILE_NAME), nil
+}
+
+// loadedManIndex holds the index once it has been read, so that the
+// queries of one run share it.
+var loadedManIndex struct {
+	sync.Mutex
+	index *ManIndex
+}
+
+// LoadManIndex reads the cached index and brings it up to date with the
+// man directories, rescanning only directories whose contents changed.
+// This happens once per run; later calls return the same index.
+func LoadManIndex(ctx context.Context, cfg IndexConfig) (*ManIndex, error) {
+	loadedManIndex.Lock()
+	defer loadedManIndex.Unlock()
+	if loadedManIndex.index != nil {
+		return loadedManIndex.index, nil
+	}
+
+	indexPath, err := ManIndexPath()
+	if err != nil {
+		return nil, err
+	}
+	idx := readManIndex(indexPath)
+	changed, err := idx.update(ctx, cfg, false)
+	if err != nil {
+		return nil, err
+	}
+	if changed {
+		if err := idx.save(indexPath); err != nil {
+			return nil, err
+		}
+	}
+	loadedManIndex.index = idx
+	return idx, nil
+}
+
+// RebuildManIndex discards the cached index and indexes every page again.
+func RebuildManIndex(ctx context.Context, cfg IndexConfig) (*ManIndex, error) {
+	indexPath, err := ManIndexPath()
+	if err != nil {
+		return nil, err
+	}
+	idx := &ManIndex{}
+	if _, err := idx.update(ctx, cfg, true); err != nil {
+		return nil, err
+	}
+	if err := idx.save(indexPath); err != nil {
+		return nil, err
+	}
+	loadedManIndex.Lock()
+	loadedManIndex.index = idx
+	loadedManIndex.Unlock()
+	return idx, nil
+}
+
+func readManIndex(path string) *ManIndex {
+	file, err := os.Open(path)
+	if err != nil {
+		return &ManIndex{}
+	}
+	defer file.Close()
+	var idx ManIndex
+	if err := gob.NewDecoder(bufio.NewReader(file)).Decode(&idx); err != nil || idx.Version != manIndexVersion {
+		return &ManIndex{}
+	}
+	idx.reindexNames()
+	return &idx
+}
+
+func (idx *ManIndex) save(path string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), "man-index-*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	writer := bufio.NewWriter(tmp)
+	if err := gob.NewEncoder(writer).Encode(idx); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := writer.Flush(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// Len is the number of indexed pages.
+func (idx *ManIndex) Len() int {
+	if idx == nil {
+		return 0
+	}
+	return len(idx.Docs)
+}
+
+func (idx *ManIndex) update(ctx context.Context, cfg IndexConfig, force bool) (bool, error) {
+	if force || idx.Version != manIndexVersion {
+		*idx = ManIndex{}
+	}
+	idx.Version = manIndexVersion
+	if idx.Dirs == nil {
+		idx.Dirs = make(map[string]dirFingerprint)
+	}
+
+	previous := make(map[string]ManIndexDoc, len(idx.Docs))
+	for _, doc := range idx.Docs {
+		previous[doc.Path] = doc
+	}
+
+	var manDirs []string
+	for _, section := range []string{"1", "8"} {
+		for _, root := range manSearchPath() {
+			manDirs = append(manDirs, filepath.Join(root, "man"+section))
+		}
+	}
+	var tldrDirs []string
+	if cfg.Tldr {
+		tldrDirs = resolveTldrDirs(cfg.TldrDirs)
+	}
+
+	catalogDirs := resolveCatalogDirs(cfg.Catalogs)
+
+	current := make(map[string]dirFingerprint)
+	changed := force
+	track := func(dir string, fingerprint dirFingerprint, ok bool) {
+		if !ok {
+			return
+		}
+		current[dir] = fingerprint
+		if idx.Dirs[dir] != fingerprint {
+			changed = true
+		}
+	}
+	for _, dir := range append(append([]string{}, manDirs...), tldrDirs...) {
+		fingerprint, ok := fingerprintDir(dir)
+		track(dir, fingerprint, ok)
+	}
+	for _, dir := range catalogDirs {
+		fingerprint, ok := fingerprintCatalogDir(dir)
+		track(dir, fingerprint, ok)
+	}
+	if len(current) != len(idx.Dirs) {
+		changed = true
+	}
+	if !changed {
+		idx.reindexNames()
+		return false, nil
+	}
+
+	// Pages reachable under several names (symlinks, .so stubs) are
+	// indexed once under their own name, the others become aliases.
+	type pageFile struct {
+		name, section, path string
+		modTime             int64
+	}
+	groups := make(map[string][]pageFile)
+	var targets []string
+	seenNames := make(map[string]struct{})
+	for _, dir := range manDirs {
+		if _, ok := current[dir]; !ok {
+			continue
+		}
+		if err := ctx.Err(); err != nil {
+			return false, err
+		}
+		section := strings.TrimPrefix(filepath.Base(dir), "man")
+		files, err := os.ReadDir(dir)
+		if err != nil {
+			continue
+		}
+		for _, file := range files {
+			name := manPageName(file.Name())
+			if _, ok := seenNames[name]; ok {
+				continue
+			}
+			path := filepath.Join(dir, file.Name())
+			info, err := os.Stat(path)
+			if err != nil || info.IsDir() {
+				continue
+			}
+			seenNames[name] = struct{}{}
+			target := manPageTarget(path, info.Size())
+			if _, ok := groups[target]; !ok {
+				targets = append(targets, target)
+			}
+			groups[target] = append(groups[target], pageFile{name, section, path, info.ModTime().Unix()})
+		}
+	}
+
+	var docs []ManIndexDoc
+	aliases := make(map[string]string)
+	seen := make(map[string]int)
+	for _, target := range targets {
+		if err := ctx.Err(); err != nil {
+			return false, err
+		}
+		files := groups[target]
+		canonical := files[0]
+		for _, file := range files {
+			if manPageName(filepath.Base(target)) == file.name {
+				canonical = file
+				break
+			}
+		}
+		doc, ok := previous[canonical.path]
+		if !ok || doc.ModTime != canonical.modTime || doc.TldrPath != "" {
+			doc, ok = indexManPage(canonical.name, canonical.section, canonical.path, canonical.modTime)
+			if !ok {
+				continue
+			}
+		}
+		for _, file := range files {
+			if file.name != canonical.name {
+				aliases[file.name] = canonical.name
+			}
+		}
+		seen[doc.Name] = len(docs)
+		docs = append(docs, doc)
+	}
+	for _, dir := range tldrDirs {
+		if _, ok := current[dir]; !ok {
+			continue
+		}
+		files, _ := filepath.Glob(filepath.Join(dir, "*.md"))
+		for _, path := range files {
+			name := strings.TrimSuffix(filepath.Base(path), ".md")
+			description, terms := indexTldrPage(path)
+			if i, ok := seen[name]; ok {
+				if docs[i].TldrPath == "" {
+					docs[i].TldrPath = path
+					for term, count := range terms {
+						docs[i].Terms[term] += count
+						docs[i].Length += count
+					}
+				}
+				continue
+			}
+			length := 0
+			for _, count := range terms {
+				length += count
+			}
+			seen[name] = len(docs)
+			docs = append(docs, ManIndexDoc{
+				Name:        name,
+				Section:     "tldr",
+				TldrPath:    path,
+				Description: description,
+				Terms:       terms,
+				Length:      length,
+			})
+		}
+	}
+
+	// Catalog entries describe the team's own tools and win over a man
+	// page that happens to share the name.
+	for _, dir := range catalogDirs {
+		if _, ok := current[dir]; ok {
+			docs = addCatalogDocs(docs, seen, dir)
+		}
+	}
+
+	idx.Aliases = aliases
+	idx.Dirs = current
+	idx.setDocs(docs)
+	return true, nil
+}
+
+// addCatalogDocs appends the entries of the catalog in dir to docs, in
+// place of those already there under the same name.
+func addCatalogDocs(docs []ManIndexDoc, seen map[string]int, dir string) []ManIndexDoc {
+	for _, path := range catalogFiles(dir) {
+		entries, err := readCatalogFile(path)
+		if err != nil {
+			continue
+		}
+		for _, entry := range entries {
+			terms := indexCatalogEntry(entry)
+			length := 0
+			for _, count := range terms {
+				length += count
+			}
+			doc := ManIndexDoc{
+				Name:        entry.Name,
+				Section:     "catalog",
+				CatalogPath: path,
+				Description: entry.Description,
+				Terms:       terms,
+				Length:      length,
+			}
+			if i, ok := seen[entry.Name]; ok {
+				docs[i] = doc
+				continue
+			}
+			seen[entry.Name] = len(docs)
+			docs = append(docs, doc)
+		}
+	}
+	return docs
+}
+
+// setDocs makes docs the indexed pages and computes the statistics BM25
+// needs.
+func (idx *ManIndex) setDocs(docs []ManIndexDoc) {
+	idx.Docs = docs
+	idx.DocFreq = make(map[string]int)
+	idx.AvgTerms = 0
+	totalTerms := 0
+	for _, doc := range docs {
+		totalTerms += doc.Length
+		for term := range doc.Terms {
+			idx.DocFreq[term]++
+		}
+	}
+	if len(docs) > 0 {
+		idx.AvgTerms = float64(totalTerms) / float64(len(docs))
+	}
+	idx.reindexNames()
+}
+
+// readCatalogIndex indexes only the catalogs, read directly, for when the
+// cached index cannot be loaded.
+func readCatalogIndex(cfg IndexConfig) *ManIndex {
+	idx := &ManIndex{Version: manIndexVersion, catalogOnly: true}
+	var docs []ManIndexDoc
+	seen := make(map[string]int)
+	for _, dir := range resolveCatalogDirs(cfg.Catalogs) {
+		docs = addCatalogDocs(docs, seen, dir)
+	}
+	idx.setDocs(docs)
+	return idx
+}
+
+// loadReferenceIndex loads the index, falling back to the catalogs alone
+// when it cannot be loaded or has no man pages. The result is nil only
+// when there is nothing to search.
+func loadReferenceIndex(ctx context.Context, cfg IndexConfig) *ManIndex {
+	if index, err := LoadManIndex(ctx, cfg); err == nil && index.Len() > 0 {
+		return index
+	}
+	if catalogs := readCatalogIndex(cfg); catalogs.Len() > 0 {
+		return catalogs
+	}
+	return nil
+}
+
+// hasManPages reports whether the index covers the man pages, rather than
+// only the catalogs.
+func (idx *ManIndex) hasManPages() bool {
+	return idx != nil && !idx.catalogOnly
+}
+
+func (idx *ManIndex) reindexNames() {
+	idx.byName = make(map[string]int, len(idx.Docs))
+	for i, doc := range idx.Docs {
+		if _, ok := idx.byName[doc.Name]; !ok {
+			idx.byName[doc.Name] = i
+		}
+	}
+}
+
+// Lookup returns the indexed page named name.
+func (idx *ManIndex) Lookup(name string) (ManIndexDoc, bool) {
+	if idx == nil {
+		return ManIndexDoc{}, false
+	}
+	i, ok := idx.byName[name]
+	if !ok {
+		if i, ok = idx.byName[idx.Aliases[name]]; !ok {
+			return ManIndexDoc{}, false
+		}
+	}
+	return idx.Docs[i], true
+}
+
+// Search ranks pages against the keywords with BM25 and returns up to
+// limit page names. Only pages about the query are returned, for commands
+// installed on PATH or in the catalog, so that "compress" finds gzip or
+// tar rather than library pages nobody can run, and only those scoring
+// close to the best match.
+func (idx *ManIndex) Search(keywords []string, limit int) []string {
+	if idx == nil || len(idx.Docs) == 0 || limit <= 0 {
+		return nil
+	}
+	var terms []string
+	for _, keyword := range keywords {
+		for _, term := range indexTerms(keyword) {
+			if !slices.Contains(terms, term) {
+				terms = append(terms, term)
+			}
+		}
+	}
+	if len(terms) == 0 {
+		return nil
+	}
+
+	type scored struct {
+		doc   int
+		score float64
+	}
+	var results []scored
+	n := float64(len(idx.Docs))
+	for i, doc := range idx.Docs {
+		score := 0.0
+		for _, term := range terms {
+			tf := float64(doc.Terms[term])
+			if tf == 0 {
+				continue
+			}
+			df := float64(idx.DocFreq[term])
+			idf := math.Log(1 + (n-df+0.5)/(df+0.5))
+			norm := tf + bm25K1*(1-bm25B+bm25B*float64(doc.Length)/math.Max(idx.AvgTerms, 1))
+			score += idf * tf * (bm25K1 + 1) / norm
+		}
+		if score > 0 {
+			results = append(results, scored{doc: i, score: score})
+		}
+	}
+	sort.Slice(results, func(i, j int) bool { return results[i].score > results[j].score })
+
+	var names []string
+	best := 0.0
+	for _, result := range results[:min(len(results), manIndexSearchCandidates)] {
+		doc := idx.Docs[result.doc]
+		if !doc.about(terms) {
+			continue
+		}
+		if doc.CatalogPath == "" {
+			if _, err := exec.LookPath(doc.Name); err != nil {
+				continue
+			}
+		}
+		if best == 0 {
+			best = result.score
+		}
+		if result.score < best*manIndexMinRelativeScore || len(names) >= limit {
+			break
+		}
+		names = append(names, doc.Name)
+	}
+	return names
+}
+
+// about reports whether the name or summary of the page has one of terms
+// other than the generic ones. A page that only mentions the query further
+// down, as gencmn does "bigger", is about something else.
+func (doc ManIndexDoc) about(terms []string) bool {
+	summary := termSet(doc.Name + " " + doc.Description)
+	for _, term := range terms {
+		if _, generic := genericWords[term]; generic {
+			continue
+		}
+		if _, ok := summary[term]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// manPageTarget identifies the file that really holds a page's text,
+// resolving symlinks and, for files small enough to be one, .so stubs.
+func manPageTarget(path string, size int64) string {
+	target, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		target = path
+	}
+	if size < 256 {
+		if _, resolved, err := resolveManSource(target); err == nil {
+			if real, err := filepath.EvalSymlinks(resolved); err == nil {
+				return real
+			}
+			return resolved
+		}
+	}
+	return target
+}
+
+func fingerprintDir(dir string) (dirFingerprint, bool) {
+	info, err := os.Stat(dir)
+	if err != nil || !info.IsDir() {
+		return dirFingerprint{}, false
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return dirFingerprint{}, false
+	}
+	return dirFingerprint{ModTime: info.ModTime().UnixNano(), Entries: len(entries)}, true
+}
+
+func resolveTldrDirs(configured []string) []string {
+	candidates := configured
+	if len(candidates) == 0 {
+		candidates = defaultTldrDirs
+	}
+	home, _ := os.UserHomeDir()
+	var dirs []string
+	for _, dir := range candidates {
+		if strings.HasPrefix(dir, "~/") && home != "" {
+			dir = filepath.Join(home, dir[2:])
+		}
+		// tldr clients keep pages per platform below the pages directory.
+		for _, platform := range []string{"common", tldrPlatform()} {
+			if info, err := os.Stat(filepath.Join(dir, platform)); err == nil && info.IsDir() {
+				dirs = append(dirs, filepath.Join(dir, platform))
+			}
+		}
+	}
+	return dirs
+}
+
+func indexManPage(name, section, path string, modTime int64) (ManIndexDoc, bool) {
+	source, err := readManSource(path)
+	if err != nil {
+		return ManIndexDoc{}, false
+	}
+	sections := splitManSections(renderRoff(source))
+	summary := sections["NAME"]
+	if summary == "" {
+		return ManIndexDoc{}, false
+	}
+	description := strings.Join(strings.Fields(summary), " ")
+	if _, after, ok := strings.Cut(description, " - "); ok {
+		description = strings.TrimSpace(after)
+	}
+	body := sections["DESCRIPTION"]
+	if len(body) > maxIndexedDescription {
+		body = body[:maxIndexedDescription]
+	}
+
+	terms := make(map[string]int)
+	addNameTerms(terms, name)
+	addTerms(terms, description, manIndexSummaryWeight)
+	addTerms(terms, sections["SYNOPSIS"], manIndexSynopsisWeight)
+	addTerms(terms, body, 1)
+	length := 0
+	for _, count := range terms {
+		length += count
+	}
+	return ManIndexDoc{
+		Name:        name,
+		Section:     section,
+		Path:        path,
+		Description: description,
+		ModTime:     modTime,
+		Terms:       terms,
+		Length:      length,
+	}, true
+}
+
+func indexTldrPage(path string) (string, map[string]int) {
+	terms := make(map[string]int)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", terms
+	}
+	description := ""
+	for _, line := range strings.Split(string(data), "\n") {
+		switch {
+		case strings.HasPrefix(line, "> ") && description == "":
+			description = strings.TrimSpace(strings.TrimPrefix(line, "> "))
+			addTerms(terms, description, manIndexSummaryWeight)
+		case strings.HasPrefix(line, "- "):
+			addTerms(terms, line, 1)
+		}
+	}
+	addNameTerms(terms, strings.TrimSuffix(filepath.Base(path), ".md"))
+	return description, terms
+}
+
+func addTerms(terms map[string]int, text string, weight int) {
+	for _, word := range extractKeywords(text) {
+		for _, term := range indexTerms(word) {
+			terms[term] += weight
+		}
+	}
+}
+
+// addNameTerms weights the full page name heavily but the parts of a
+// hyphenated name like git-upload-archive only as much as body text.
+func addNameTerms(terms map[string]int, name string) {
+	for i, term := range indexTerms(strings.ToLower(name)) {
+		if i == 0 {
+			terms[term] += manIndexNameWeight
+			continue
+		}
+		terms[term]++
+	}
+}
+
+// indexTerms normalises a keyword for the index: the stemmed word itself
+// plus its parts when it is hyphenated.
+func indexTerms(keyword string) []string {
+	keyword = strings.Trim(keyword, "-_")
+	if len(keyword) < 2 {
+		return nil
+	}
+	terms := []string{stemWord(keyword)}
+	if strings.ContainsAny(keyword, "-_") {
+		for _, part := range strings.FieldsFunc(keyword, func(r rune) bool { return r == '-' || r == '_' }) {
+			if len(part) >= 2 {
+				terms = append(terms, stemWord(part))
+			}
+		}
+	}
+	return terms
+}
+
+// splitManSections maps each top-level section header of rendered man text
+// to its body.
+func splitManSections(manText string) map[string]string {
+	sections := make(map[string]string)
+	current := ""
+	var body strings.Builder
+	flush := func() {
+		if current != "" {
+			sections[current] = strings.TrimSpace(body.String())
+		}
+		body.Reset()
+	}
+	for _, line := range strings.Split(manText, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if trimmed != "" && line == strings.TrimLeft(line, " \t") && isSectionHeader(trimmed) {
+			flush()
+			current = trimmed
+			continue
+		}
+		if current != "" {
+			body.WriteString(line)
+			body.WriteString("\n")
+		}
+	}
+	flush()
+	return sections
+}
+
+func tldrPlatform() string {
+	switch goos := runtime.GOOS; goos {
+	case "darwin":
+		return "osx"
+	default:
+		return goos
+	}
+}
+
+// readTldrPage returns the tldr page as a compact reference excerpt.
+func readTldrPage(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	var lines []string
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = strings.TrimPrefix(line, "> ")
+		line = strings.Trim(line, "`")
+		lines = append(lines, line)
+	}
+	if len(lines) == 0 {
+		return "", fmt.Errorf("empty tldr page %s", path)
+	}
+	return "EXAMPLES\n" + strings.Join(lines, "\n"), nil
+}
@@ -0,0 +1,341 @@
+package model
+
+import (
+	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+)
+
+const (
+	maxManSourceBytes = 2 * 1024 * 1024
+	maxSoRedirects    = 4
+)
+
+var defaultManDirs = []string{
+	"/usr/local/share/man",
+	"/usr/share/man",
+	"/usr/local/man",
+	"/opt/homebrew/share/man",
+	"/opt/local/share/man",
+}
+
+// manCommandSections are searched in order when looking up a command.
+var manCommandSections = []string{"1", "8", "6"}
+
+// manSearchPath returns the man roots from MANPATH, where an empty entry
+// stands for the default locations, followed by the defaults.
+func manSearchPath() []string {
+	var roots []string
+	seen := make(map[string]struct{})
+	add := func(dir string) {
+		if dir == "" {
+			return
+		}
+		if _, ok := seen[dir]; ok {
+			return
+		}
+		if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+			return
+		}
+		seen[dir] = struct{}{}
+		roots = append(roots, dir)
+	}
+
+	manPath := os.Getenv("MANPATH")
+	defaultsAdded := false
+	for _, dir := range filepath.SplitList(manPath) {
+		if dir == "" && !defaultsAdded {
+			for _, def := range defaultManDirs {
+				add(def)
+			}
+			defaultsAdded = true
+			continue
+		}
+		add(dir)
+	}
+	if !defaultsAdded {
+		for _, def := range defaultManDirs {
+			add(def)
+		}
+	}
+	if runtime.GOOS == "darwin" {
+		add("/Library/Developer/CommandLineTools/usr/share/man")
+	}
+	return roots
+}
+
+// findManPage locates the source file of the page for name in the given
+// sections, trying the command sections when none are given.
+func findManPage(name string, sections ...string) string {
+	if name == "" || strings.ContainsAny(name, "/*?[") {
+		return ""
+	}
+	if len(sections) == 0 {
+		sections = manCommandSections
+	}
+	roots := manSearchPath()
+	for _, section := range sections {
+		for _, root := range roots {
+			matches, _ := filepath.Glob(filepath.Join(root, "man"+section, name+"."+section+"*"))
+			for _, match := range matches {
+				if isManPageFile(filepath.Base(match), name) {
+					return match
+				}
+			}
+		}
+	}
+	return ""
+}
+
+// isManPageFile accepts name.1, name.1ssl, name.1.gz and similar, but not
+// name.1.html or pages of other commands sharing the prefix.
+func isManPageFile(base, name string) bool {
+	rest, ok := strings.CutPrefix(base, name+".")
+	if !ok || rest == "" {
+		return false
+	}
+	for _, ext := range []string{".gz", ".bz2"} {
+		rest = strings.TrimSuffix(rest, ext)
+	}
+	return !strings.Contains(rest, ".")
+}
+
+// manPageName returns the page name for a file such as tar.1.gz.
+func manPageName(base string) string {
+	for _, ext := range []string{".gz", ".bz2"} {
+		base = strings.TrimSuffix(base, ext)
+	}
+	if idx := strings.LastIndex(base, "."); idx > 0 {
+		return base[:idx]
+	}
+	return base
+}
+
+// readManSource reads a page, decompressing it and following .so redirects.
+func readManSource(path string) (string, error) {
+	source, _, err := resolveManSource(path)
+	return source, err
+}
+
+// resolveManSource is readManSource that also reports the file the source
+// was finally read from.
+func resolveManSource(path string) (string, string, error) {
+	for range maxSoRedirects {
+		data, err := readMaybeCompressed(path)
+		if err != nil {
+			return "", "", err
+		}
+		text := string(data)
+		target, ok := soTarget(text)
+		if !ok {
+			return text, path, nil
+		}
+		// .so paths are relative to the man root, one level above manN.
+		root := filepath.Dir(filepath.Dir(path))
+		resolved := filepath.Join(root, target)
+		if _, err := os.Stat(resolved); err != nil {
+			matches, _ := filepath.Glob(resolved + ".*")
+			if len(matches) == 0 {
+				return "", "", fmt.Errorf("man page %s redirects to missing %s", path, target)
+			}
+			resolved = matches[0]
+		}
+		path = resolved
+	}
+	return "", "", fmt.Errorf("too many .so redirects for %s", path)
+}
+
+func readMaybeCompressed(path string) ([]byte, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var reader io.Reader = file
+	switch {
+	case strings.HasSuffix(path, ".gz"):
+		gz, err := gzip.NewReader(file)
+		if err != nil {
+			return nil, err
+		}
+		defer gz.Close()
+		reader = gz
+	case strings.HasSuffix(path, ".bz2"):
+		reader = bzip2.NewReader(file)
+	}
+	return io.ReadAll(io.LimitReader(reader, maxManSourceBytes))
+}
+
+func soTarget(text string) (string, bool) {
+	trimmed := strings.TrimSpace(text)
+	if !strings.HasPrefix(trimmed, ".so ") || strings.Contains(trimmed, "\n") {
+		return "", false
+	}
+	return strings.TrimSpace(strings.TrimPrefix(trimmed, ".so ")), true
+}
+
+// readManPage finds and renders the page for command as plain text.
+func readManPage(command string) (string, error) {
+	path := findManPage(command)
+	if path == "" {
+		return "", fmt.Errorf("no man page for %s", command)
+	}
+	source, err := readManSource(path)
+	if err != nil {
+		return "", err
+	}
+	return renderRoff(source), nil
+}
+
+// ManEntry is one NAME section line, as printed by apropos.
+type ManEntry struct {
+	Name        string
+	Section     string
+	Description string
+	Path        string
+}
+
+// scanManEntries reads the NAME section of every command page. Reading
+// stops early when ctx is done.
+func scanManEntries(ctx context.Context) []ManEntry {
+	var entries []ManEntry
+	seen := make(map[string]struct{})
+	for _, section := range manCommandSections {
+		for _, root := range manSearchPath() {
+			files, err := os.ReadDir(filepath.Join(root, "man"+section))
+			if err != nil {
+				continue
+			}
+			for _, file := range files {
+				if ctx.Err() != nil {
+					return entries
+				}
+				name := manPageName(file.Name())
+				if _, ok := seen[name]; ok {
+					continue
+				}
+				path := filepath.Join(root, "man"+section, file.Name())
+				entry, ok := readManEntry(path, section)
+				if !ok {
+					continue
+				}
+				entry.Name = name
+				seen[name] = struct{}{}
+				entries = append(entries, entry)
+			}
+		}
+	}
+	return entries
+}
+
+func readManEntry(path, section string) (ManEntry, bool) {
+	source, err := readManSource(path)
+	if err != nil {
+		return ManEntry{}, false
+	}
+	description := nameSectionDescription(source)
+	if description == "" {
+		return ManEntry{}, false
+	}
+	return ManEntry{Section: section, Description: description, Path: path}, true
+}
+
+// nameSectionDescription renders just the NAME section and returns the text
+// after the dash, e.g. "an archiving utility" for tar.
+func nameSectionDescription(source string) string {
+	var nameLines []string
+	inName := false
+	scanner := bufio.NewScanner(strings.NewReader(source))
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if macro, args := splitRoffRequest(line); macro == "SH" || macro == "Sh" {
+			if inName {
+				break
+			}
+			inName = strings.EqualFold(roffJoin(args, " "), "NAME")
+			continue
+		}
+		if inName {
+			nameLines = append(nameLines, line)
+		}
+	}
+	if len(nameLines) == 0 {
+		return ""
+	}
+	text := strings.Join(strings.Fields(renderRoff(strings.Join(nameLines, "\n"))), " ")
+	if _, after, ok := strings.Cut(text, " - "); ok {
+		return strings.TrimSpace(after)
+	}
+	return text
+}
+
+// searchManEntries ranks pages whose name or description mention keyword:
+// exact names first, then name prefixes, then descriptions.
+func searchManEntries(entries []ManEntry, keyword string, limit int) []string {
+	type match struct {
+		name string
+		rank int
+	}
+	var matches []match
+	for _, entry := range entries {
+		name := strings.ToLower(entry.Name)
+		switch {
+		case name == keyword:
+			matches = append(matches, match{entry.Name, 0})
+		case strings.HasPrefix(name, keyword):
+			matches = append(matches, match{entry.Name, 1})
+		case containsWord(strings.ToLower(entry.Description), keyword):
+			matches = append(matches, match{entry.Name, 2})
+		}
+	}
+	sort.SliceStable(matches, func(i, j int) bool { return matches[i].rank < matches[j].rank })
+
+	var names []string
+	for _, m := range matches {
+		names = append(names, m.name)
+		if len(names) >= limit {
+			break
+		}
+	}
+	return names
+}
+
+func containsWord(text, word string) bool {
+	for _, field := range extractKeywords(text) {
+		if field == word || strings.HasPrefix(field, word) && len(field)-len(word) <= 3 {
+			return true
+		}
+	}
+	return false
+}
+
+// stripOverstrike removes the backspace bold/underline sequences that man
+// emits when its output is not a terminal, replacing the col -b pipeline.
+func stripOverstrike(text string) string {
+	if !strings.Contains(text, "\b") {
+		return text
+	}
+	var out bytes.Buffer
+	runes := []rune(text)
+	for i := 0; i < len(runes); i++ {
+		if i+2 < len(runes) && runes[i+1] == '\b' {
+			continue
+		}
+		if runes[i] == '\b' {
+			continue
+		}
+		out.WriteRune(runes[i])
+	}
+	return out.String()
+}
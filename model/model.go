@@ -3,23 +3,21 @@ package model
 import (
 	"bytes"
 	"context"
-	"encoding/json"
 	"fmt"
 	"os"
 	"os/exec"
+	"slices"
+	"strconv"
 	"strings"
 	"time"
 )
 
-type Result struct {
-	Cmd     string   `json:"cmd"`
-	Args    []string `json:"args"`
-	Explain string   `json:"explain"`
-}
-
 type Model struct {
 	manifest Manifest
 	Config   Config
+	// Secrets holds the secrets redacted from the last query, to keep
+	// them out of history and logs as well.
+	Secrets *Redactor
 }
 
 func NewModel() (Model, error) {
@@ -46,6 +44,9 @@ func (m *Model) GetLlamaAsset() Asset {
 }
 
 func (m *Model) EnsureAssets() error {
+	if !m.Config.Org.BackendAllowed(backendLlamafile) {
+		return fmt.Errorf("the %s backend is not allowed by %s", backendLlamafile, m.Config.Org.Path)
+	}
 	if err := m.GetLlamaAsset().Ensure(); err != nil {
 		return err
 	}
@@ -55,42 +56,175 @@ func (m *Model) EnsureAssets() error {
 	return nil
 }
 
+// Environment collects the host facts that are sent along with every query.
+func (m *Model) Environment() Environment {
+	return CollectEnvironment(m.Config.Environment)
+}
+
+// Ask turns userInput into suggestions, each judged by the safety policy.
+// Secrets in the query never reach the model; they are put back into the
+// suggestions afterwards. Made-up values such as /path/to/dir become
+// placeholders. Suggestions the organisation policy forbids are dropped.
 func (m *Model) Ask(userInput string) ([]Result, error) {
-	// Get current working directory for context
+	m.Secrets = NewRedactor()
+	return m.ask(userInput, nil)
+}
 
-	manReference := buildManReference(userInput)
-	prompt := buildPrompt(userInput, manReference)
-	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+func (m *Model) ask(userInput string, corrections []string) ([]Result, error) {
+	policy, err := NewPolicy(m.Config.SafetyPolicy())
+	if err != nil {
+		return nil, err
+	}
+	results, err := m.suggest(userInput, corrections)
+	allowed := results[:0]
+	for _, result := range results {
+		result = guessPlaceholders(m.Secrets.RestoreResult(result), userInput)
+		result.Decision = policy.Evaluate(result)
+		if !result.Decision.Forbidden {
+			allowed = append(allowed, result)
+		}
+	}
+	return allowed, err
+}
+
+// suggest asks the model for commands, telling it about the corrections
+// to earlier answers, if any.
+func (m *Model) suggest(userInput string, corrections []string) ([]Result, error) {
+	// Only what comes from the user is redacted: the query, the context,
+	// which can hold a token in a git remote, and the corrections, which
+	// can quote a failed command's output. Man pages and examples are
+	// left alone; their --password=password is not a secret.
+	userInput = m.Secrets.Redact(userInput)
+	promptContext := m.Secrets.redactContext(m.Context(userInput))
+	corrections = m.Secrets.redactAll(corrections)
+	ctx, cancel := context.WithTimeout(context.Background(), 120*time.Second)
 	defer cancel()
+	reference := buildManReference(ctx, userInput, m.Config.Index, m.Config.References)
+	examples := findFewShotExamples(userInput)
+	builder := NewPromptBuilder(templateFor(m.Config.Model, m.Config.Prompt))
+	builder.Corrections = corrections
+
+	build := func(pb PromptBuilder) string {
+		return pb.Build(userInput, promptContext, reference, examples)
+	}
+
+	results, err := m.generate(ctx, builder, build)
+	if err != nil || m.Config.Validation.Disabled {
+		return results, err
+	}
+
+	index := loadReferenceIndex(ctx, m.Config.Index)
+	validator := NewValidator(index)
+	validateCtx, cancelValidate := context.WithTimeout(ctx, validationTimeout)
+	results = validateResults(validateCtx, validator, results)
+	cancelValidate()
+	if countWarnings(results) == 0 || m.Config.Validation.NoRegenerate {
+		return results, nil
+	}
+
+	// Ask once more with the problems spelled out, and keep whichever
+	// answer has fewer of them.
+	builder.Corrections = append(slices.Clip(corrections), validationFeedback(results)...)
+	retried, err := m.generate(ctx, builder, build)
+	if err != nil {
+		return results, nil
+	}
+	validateCtx, cancelValidate = context.WithTimeout(ctx, validationTimeout)
+	retried = validateResults(validateCtx, validator, retried)
+	cancelValidate()
+	if len(retried) > 0 && countWarnings(retried) < countWarnings(results) {
+		return retried, nil
+	}
+	return results, nil
+}
+
+// generationAttempt is how one attempt at an answer is made.
+type generationAttempt struct {
+	maxResults  int
+	nPredict    int
+	temperature float64
+}
 
+// generationAttempts is the retry policy for answers that cannot be
+// parsed: each attempt leaves more room for output, samples more
+// conservatively and asks for fewer commands.
+var generationAttempts = []generationAttempt{
+	{maxResults: 4, nPredict: maxOutputTokens, temperature: 0.3},
+	{maxResults: 2, nPredict: maxOutputTokens + 200, temperature: 0.1},
+	{maxResults: 1, nPredict: maxOutputTokens + 400, temperature: 0},
+}
+
+// generate asks the model until one attempt yields at least one complete
+// command, and returns a GenerationError when none does.
+func (m *Model) generate(ctx context.Context, builder PromptBuilder, build func(PromptBuilder) string) ([]Result, error) {
+	return generateWith(ctx, m, resultGrammar, generationAttempts, builder, build, parseResults)
+}
+
+// generateWith makes the attempts in turn until parse accepts the output
+// of one.
+func generateWith[T any](ctx context.Context, m *Model, grammar string, attempts []generationAttempt, builder PromptBuilder, build func(PromptBuilder) string, parse func(string) ([]T, error)) ([]T, error) {
+	var lastErr error
+	var lastRaw string
+	made := 0
+	for _, attempt := range attempts {
+		made++
+		builder.MaxResults = attempt.maxResults
+		raw, err := m.runModel(ctx, grammar, build(builder), attempt.nPredict, attempt.temperature)
+		if err != nil {
+			// The model did not run at all; trying again will not help.
+			return nil, err
+		}
+		items, err := parse(raw)
+		if err == nil {
+			return items, nil
+		}
+		lastErr, lastRaw = err, raw
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	return nil, &GenerationError{Attempts: made, Raw: lastRaw, Err: lastErr}
+}
+
+// runModel runs llamafile on prompt, constrained by grammar, and returns
+// its output.
+func (m *Model) runModel(ctx context.Context, grammar, prompt string, nPredict int, temperature float64) (string, error) {
 	llamaFilePath, err := m.GetLlamaAsset().FullPath()
 	if err != nil {
-		return nil, fmt.Errorf("failed to get llamafile path: %v", err)
+		return "", fmt.Errorf("failed to get llamafile path: %v", err)
 	}
 	modelPath, err := m.GetModelAsset().FullPath()
 	if err != nil {
-		return nil, fmt.Errorf("failed to get model path: %v", err)
+		return "", fmt.Errorf("failed to get model path: %v", err)
 	}
 
-	// GBNF grammar for JSON array of command objects
-	// More flexible grammar that allows for proper JSON structure
-	gbnf := `root ::= ws "[" ws (object (ws "," ws object)*)? ws "]" ws
-object ::= "{" ws "\"cmd\"" ws ":" ws string ws "," ws "\"args\"" ws ":" ws array ws "," ws "\"explain\"" ws ":" ws string ws "}"
-array ::= "[" ws (string (ws "," ws string)*)? ws "]"
-string ::= "\"" char* "\""
-char ::= [^"\\] | "\\" (["\\/bfnrt] | "u" [0-9a-fA-F] [0-9a-fA-F] [0-9a-fA-F] [0-9a-fA-F])
-ws ::= [ \t\n\r]*`
-
 	tmp, err := os.CreateTemp("", "command_*.gbnf")
 	if err != nil {
 		panic(err)
 	}
 	defer os.Remove(tmp.Name())
-	if _, err := tmp.WriteString(gbnf); err != nil {
+	if _, err := tmp.WriteString(grammar); err != nil {
 		panic(err)
 	}
 	tmp.Close()
 
+	// The prompt goes in a file only this user can read, not in the
+	// arguments, which any user can see in ps.
+	promptFile, err := os.CreateTemp("", "prompt_*.txt")
+	if err != nil {
+		return "", fmt.Errorf("failed to create prompt file: %w", err)
+	}
+	defer os.Remove(promptFile.Name())
+	if err := promptFile.Chmod(0600); err != nil {
+		promptFile.Close()
+		return "", fmt.Errorf("failed to create prompt file: %w", err)
+	}
+	if _, err := promptFile.WriteString(prompt); err != nil {
+		promptFile.Close()
+		return "", fmt.Errorf("failed to write prompt file: %w", err)
+	}
+	promptFile.Close()
+
 	llamaArgs := []string{
 		llamaFilePath,
 		"-m", modelPath,
@@ -99,10 +233,12 @@ ws ::= [ \t\n\r]*`
 		"-ngl", "32", // Enable GPU layers if available
 		"--mlock", // Lock model in memory
 		"--grammar-file", tmp.Name(),
-		"-p", prompt,
-		"--temp", "0.3", // Lower temperature for more consistent results
-		"--n-predict", "400", // Reduced for faster processing
-		"--ctx-size", "2048", // Reduced context size
+		"-f", promptFile.Name(),
+		"--temp", strconv.FormatFloat(temperature, 'f', -1, 64), // Lower temperature for more consistent results
+		"--n-predict", strconv.Itoa(nPredict),
+		// The prompt is sized for maxOutputTokens, so longer answers
+		// need a larger context.
+		"--ctx-size", strconv.Itoa(contextSize + nPredict - maxOutputTokens),
 		"--threads", "4", // Limit CPU threads
 	}
 	var stdout, stderr bytes.Buffer
@@ -111,40 +247,7 @@ ws ::= [ \t\n\r]*`
 	cmd.Stderr = &stderr
 
 	if err := cmd.Run(); err != nil {
-		return nil, fmt.Errorf("llamafile failed: %v\nstderr: %s", err, stderr.String())
-	}
-
-	raw := strings.TrimSpace(stdout.String())
-
-	// Parse the JSON response into an array of Result objects
-	var results []Result
-	if err := json.Unmarshal([]byte(raw), &results); err != nil {
-		return nil, fmt.Errorf("failed to parse JSON response: %v\nraw: %s", err, raw)
-	}
-
-	return results, nil
-}
-
-func buildPrompt(userInput, manReference string) string {
-	var builder strings.Builder
-	builder.WriteString("Generate shell commands as JSON array.\n\n")
-	builder.WriteString(fmt.Sprintf("Task: %s\n\n", userInput))
-
-	if manReference != "" {
-		builder.WriteString("Reference material from relevant man pages:\n")
-		builder.WriteString("[MANPAGE EXCERPT]\n")
-		builder.WriteString(manReference)
-		builder.WriteString("\n[/MANPAGE EXCERPT]\n\n")
+		return "", fmt.Errorf("llamafile failed: %v\nstderr: %s", err, stderr.String())
 	}
-
-	builder.WriteString("Rules:\n")
-	builder.WriteString("- Return 1-4 real Linux commands only\n")
-	builder.WriteString("- Use actual commands\n")
-	builder.WriteString("- Most common solution first\n")
-	builder.WriteString("- Args as separate array elements\n\n")
-	builder.WriteString("JSON format:\n")
-	builder.WriteString(`[{"cmd":"command","args":["arg1","arg2"],"explain":"description"}]`)
-	builder.WriteString("\n\nOutput:")
-
-	return builder.String()
+	return strings.TrimSpace(stdout.String()), nil
 }
@@ -0,0 +1,152 @@
+package model
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ORG_POLICY_FILE is where administrators put settings that users cannot
+// change. It takes precedence over config.yml.
+const ORG_POLICY_FILE = "/etc/clai/policy.yml"
+
+// backendLlamafile is the only backend clai has; allowed_backends exists so
+// that a policy keeps holding when more are added.
+const backendLlamafile = "llamafile"
+
+// OrgPolicy is the organisation-wide policy file.
+type OrgPolicy struct {
+	AllowedModels   []ModelType `yaml:"allowed_models,omitempty"`
+	AllowedBackends []string    `yaml:"allowed_backends,omitempty"`
+
+	// NoDownloads forbids fetching assets from the internet. They must be
+	// in AssetDir, or be downloadable from MirrorURL.
+	NoDownloads bool   `yaml:"no_downloads,omitempty"`
+	AssetDir    string `yaml:"asset_dir,omitempty"`
+	MirrorURL   string `yaml:"mirror_url,omitempty"`
+
+	// DeniedCommands are never suggested or run. Rules are added to the
+	// safety policy and cannot be replaced by the user's rules; with
+	// LockPolicy the user's rules are ignored altogether.
+	DeniedCommands []string     `yaml:"denied_commands,omitempty"`
+	Rules          []PolicyRule `yaml:"rules,omitempty"`
+	LockPolicy     bool         `yaml:"lock_policy,omitempty"`
+
+	DisableExecution bool `yaml:"disable_execution,omitempty"`
+
+	// RequireAudit turns the audit log on for everyone and refuses to run
+	// commands it cannot record. Audit, if set, replaces the user's audit
+	// settings.
+	RequireAudit bool        `yaml:"require_audit,omitempty"`
+	Audit        AuditConfig `yaml:"audit,omitempty"`
+
+	// Path is the file the policy was read from, empty if there is none.
+	Path string `yaml:"-"`
+}
+
+// LoadOrgPolicy reads the policy file. A missing file is no policy; a
+// file that cannot be read or parsed is an error, so that a broken policy
+// does not silently lift its restrictions.
+func LoadOrgPolicy() (OrgPolicy, error) {
+	data, err := os.ReadFile(ORG_POLICY_FILE)
+	if os.IsNotExist(err) {
+		return OrgPolicy{}, nil
+	}
+	if err != nil {
+		return OrgPolicy{}, fmt.Errorf("failed to read policy %s: %w", ORG_POLICY_FILE, err)
+	}
+	var policy OrgPolicy
+	if err := yaml.Unmarshal(data, &policy); err != nil {
+		return OrgPolicy{}, fmt.Errorf("failed to parse policy %s: %w", ORG_POLICY_FILE, err)
+	}
+	for _, name := range policy.AllowedModels {
+		if GetModel(name).Filename == "" {
+			return OrgPolicy{}, fmt.Errorf("policy %s: unknown model %q", ORG_POLICY_FILE, name)
+		}
+	}
+	if _, err := NewPolicy(PolicyConfig{DisableBuiltin: true, Rules: policy.Rules}); err != nil {
+		return OrgPolicy{}, fmt.Errorf("policy %s: %w", ORG_POLICY_FILE, err)
+	}
+	policy.Path = ORG_POLICY_FILE
+	return policy, nil
+}
+
+// Active reports whether a policy file was found.
+func (p OrgPolicy) Active() bool {
+	return p.Path != ""
+}
+
+// ModelAllowed reports whether the policy lets clai use model.
+func (p OrgPolicy) ModelAllowed(model ModelType) bool {
+	return len(p.AllowedModels) == 0 || slices.Contains(p.AllowedModels, model)
+}
+
+// BackendAllowed reports whether the policy lets clai use backend.
+func (p OrgPolicy) BackendAllowed(backend string) bool {
+	return len(p.AllowedBackends) == 0 || slices.Contains(p.AllowedBackends, backend)
+}
+
+// policyRules returns the rules the policy adds to the safety policy,
+// marked so that a match removes the suggestion.
+func (p OrgPolicy) policyRules() []PolicyRule {
+	var rules []PolicyRule
+	for _, command := range p.DeniedCommands {
+		rules = append(rules, PolicyRule{
+			Name:     "org-denied-" + command,
+			Commands: []string{command},
+			Action:   PolicyDeny,
+			Message:  "not allowed by your organisation",
+		})
+	}
+	rules = append(rules, p.Rules...)
+	for i := range rules {
+		rules[i].Locked = true
+	}
+	return rules
+}
+
+// LockedSettings describes each setting the policy fixes, for display.
+func (p OrgPolicy) LockedSettings() []string {
+	var locked []string
+	if len(p.AllowedModels) > 0 {
+		names := make([]string, len(p.AllowedModels))
+		for i, model := range p.AllowedModels {
+			names[i] = model.String()
+		}
+		locked = append(locked, "model: one of "+strings.Join(names, ", "))
+	}
+	if len(p.AllowedBackends) > 0 {
+		locked = append(locked, "backend: one of "+strings.Join(p.AllowedBackends, ", "))
+	}
+	switch {
+	case p.AssetDir != "":
+		locked = append(locked, "assets: from "+p.AssetDir)
+	case p.MirrorURL != "":
+		locked = append(locked, "assets: downloaded from "+p.MirrorURL)
+	}
+	if p.NoDownloads {
+		locked = append(locked, "downloads: forbidden")
+	}
+	if len(p.DeniedCommands) > 0 {
+		locked = append(locked, "denied commands: "+strings.Join(p.DeniedCommands, ", "))
+	}
+	if len(p.Rules) > 0 {
+		locked = append(locked, fmt.Sprintf("policy rules: %d added", len(p.Rules)))
+	}
+	if p.LockPolicy {
+		locked = append(locked, "policy: your rules are ignored")
+	}
+	if p.DisableExecution {
+		locked = append(locked, "execution: disabled")
+	}
+	if p.RequireAudit {
+		locked = append(locked, "audit log: required")
+	}
+	if p.Audit != (AuditConfig{}) {
+		locked = append(locked, "audit settings")
+	}
+	return locked
+}
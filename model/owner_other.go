@@ -0,0 +1,17 @@
+//go:build !unix
+
+package model
+
+import "io/fs"
+
+func fileOwnership(fs.FileInfo) (uid, gid int, ok bool) {
+	return 0, 0, false
+}
+
+func fileOwner(fs.FileInfo) (int, bool) {
+	return 0, false
+}
+
+func canWrite(string) bool {
+	return true
+}
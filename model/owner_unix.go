@@ -0,0 +1,31 @@
+//go:build unix
+
+package model
+
+import (
+	"io/fs"
+	"syscall"
+)
+
+// fileOwnership returns the user and group that own the file info
+// describes.
+func fileOwnership(info fs.FileInfo) (uid, gid int, ok bool) {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, 0, false
+	}
+	return int(stat.Uid), int(stat.Gid), true
+}
+
+// fileOwner returns the user that owns the file info describes.
+func fileOwner(info fs.FileInfo) (int, bool) {
+	uid, _, ok := fileOwnership(info)
+	return uid, ok
+}
+
+// canWrite reports whether the current user may create and remove entries
+// in dir.
+func canWrite(dir string) bool {
+	const wOK = 2
+	return syscall.Access(dir, wOK) == nil
+}
@@ -0,0 +1,110 @@
+package model
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf8"
+)
+
+// GenerationError is returned when no attempt produced a usable answer.
+// Raw keeps the output of the last attempt for debugging.
+type GenerationError struct {
+	Attempts int
+	Raw      string
+	Err      error
+}
+
+func (e *GenerationError) Error() string {
+	return fmt.Sprintf("the model gave no usable answer after %d attempts: %v", e.Attempts, e.Err)
+}
+
+func (e *GenerationError) Unwrap() error {
+	return e.Err
+}
+
+var errNoResults = errors.New("no complete command in the output")
+
+// parseResults decodes the model's JSON array. When the array is cut off,
+// as happens when generation hits --n-predict, the complete objects before
+// the cut are returned. Objects without a command are dropped.
+func parseResults(raw string) ([]Result, error) {
+	return parseArray(raw, func(result Result) bool {
+		return strings.TrimSpace(result.Cmd) != ""
+	})
+}
+
+// parseArray decodes the elements of the JSON array in raw that keep
+// accepts, stopping at the first one that cannot be decoded.
+func parseArray[T any](raw string, keep func(T) bool) ([]T, error) {
+	raw = sanitizeJSON(raw)
+	start := strings.IndexByte(raw, '[')
+	if start < 0 {
+		return nil, errNoResults
+	}
+
+	decoder := json.NewDecoder(strings.NewReader(raw[start:]))
+	if _, err := decoder.Token(); err != nil {
+		return nil, err
+	}
+	var items []T
+	var decodeErr error
+	for decoder.More() {
+		var item T
+		if err := decoder.Decode(&item); err != nil {
+			decodeErr = err
+			break
+		}
+		if keep(item) {
+			items = append(items, item)
+		}
+	}
+	if len(items) == 0 {
+		if errors.Is(decodeErr, io.ErrUnexpectedEOF) {
+			return nil, errors.New("the output ends before the first command is complete")
+		}
+		if decodeErr != nil {
+			return nil, decodeErr
+		}
+		return nil, errNoResults
+	}
+	return items, nil
+}
+
+// sanitizeJSON escapes raw control characters inside strings and replaces
+// invalid UTF-8, both of which the model emits now and then and
+// encoding/json rejects.
+func sanitizeJSON(raw string) string {
+	if !strings.ContainsFunc(raw, func(r rune) bool { return r < 0x20 || r == utf8.RuneError }) {
+		return raw
+	}
+	raw = strings.ToValidUTF8(raw, "�")
+	var builder strings.Builder
+	inString, escaped := false, false
+	for _, r := range raw {
+		switch {
+		case escaped:
+			escaped = false
+		case inString && r == '\\':
+			escaped = true
+		case r == '"':
+			inString = !inString
+		case inString && r < 0x20:
+			switch r {
+			case '\n':
+				builder.WriteString(`\n`)
+			case '\t':
+				builder.WriteString(`\t`)
+			case '\r':
+				builder.WriteString(`\r`)
+			default:
+				builder.WriteString(fmt.Sprintf(`\u%04x`, r))
+			}
+			continue
+		}
+		builder.WriteRune(r)
+	}
+	return builder.String()
+}
@@ -0,0 +1,221 @@
+package model
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// guessedPlaceholder is a made-up value models write where the user has
+// to supply one, such as /path/to/dir or <branch>.
+type guessedPlaceholder struct {
+	pattern *regexp.Regexp
+	// name names the placeholder after the match and its submatches.
+	name func(match []string) string
+	// inPatterns is set when the value is guessed in the arguments of
+	// pattern commands too, where <div> is more likely markup.
+	inPatterns bool
+}
+
+var guessedPlaceholders = []guessedPlaceholder{
+	{
+		pattern:    regexp.MustCompile(`(?:~/|/)?\bpath/to\b(?:/[\w.-]+)*/?`),
+		name:       func(match []string) string { return pathPlaceholderName(match[0]) },
+		inPatterns: true,
+	},
+	{
+		pattern:    regexp.MustCompile(`https?://(?:[\w-]+\.)*example\.(?:com|org|net)(?:[:/][^\s'"]*)?`),
+		name:       func([]string) string { return "url" },
+		inPatterns: true,
+	},
+	{
+		pattern:    regexp.MustCompile(`\b[\w.+-]+@(?:[\w-]+\.)*example\.(?:com|org|net)\b`),
+		name:       func([]string) string { return "address" },
+		inPatterns: true,
+	},
+	{
+		pattern:    regexp.MustCompile(`\b(?:[\w-]+\.)*example\.(?:com|org|net)\b`),
+		name:       func([]string) string { return "host" },
+		inPatterns: true,
+	},
+	{
+		pattern:    regexp.MustCompile(`/dev/sdX\d*`),
+		name:       func([]string) string { return "device" },
+		inPatterns: true,
+	},
+	{
+		pattern: regexp.MustCompile(`\b(?i:your)[_-]([\w-]+)`),
+		name:    func(match []string) string { return strings.ToLower(match[1]) },
+	},
+	{
+		pattern: regexp.MustCompile(`<([A-Za-z][\w-]*)>`),
+		name:    func(match []string) string { return match[1] },
+	},
+}
+
+// pathPlaceholderName names a /path/to value after its last part without
+// the extension: dir for /path/to/dir, file for /path/to/file.txt.
+func pathPlaceholderName(path string) string {
+	base := filepath.Base(strings.TrimSuffix(path, "/"))
+	if base == "to" {
+		return "path"
+	}
+	if name, _, ok := strings.Cut(base, "."); ok && name != "" {
+		return name
+	}
+	return base
+}
+
+// placeholderName makes text a valid placeholder name.
+func placeholderName(text string) string {
+	name := []byte(text)
+	for i, c := range name {
+		if !isIdentifierChar(c) && c != '-' {
+			name[i] = '_'
+		}
+	}
+	if trimmed := strings.Trim(string(name), "_-"); trimmed != "" {
+		return trimmed
+	}
+	return "value"
+}
+
+// guessPlaceholders turns the made-up values in result's arguments and
+// redirect targets into placeholders, so that they are filled in before
+// the command runs. Values the user wrote in userInput are real.
+func guessPlaceholders(result Result, userInput string) Result {
+	used := result.PlaceholderNames()
+	names := make(map[string]string)
+	guess := func(command, text string) string {
+		_, pattern := patternCommands[filepath.Base(command)]
+		for _, guessed := range guessedPlaceholders {
+			if pattern && !guessed.inPatterns {
+				continue
+			}
+			text = guessed.pattern.ReplaceAllStringFunc(text, func(match string) string {
+				if strings.Contains(userInput, match) {
+					return match
+				}
+				name, ok := names[match]
+				if !ok {
+					base := placeholderName(guessed.name(guessed.pattern.FindStringSubmatch(match)))
+					name = base
+					for n := 2; slices.Contains(used, name); n++ {
+						name = base + strconv.Itoa(n)
+					}
+					names[match] = name
+					used = append(used, name)
+					result.Placeholders = append(result.Placeholders, Placeholder{
+						Name:        name,
+						Description: "instead of " + match,
+					})
+				}
+				return "{{" + name + "}}"
+			})
+		}
+		return text
+	}
+
+	guessStage := func(stage Stage) Stage {
+		args := make([]string, len(stage.Args))
+		for i, arg := range stage.Args {
+			args[i] = guess(stage.Cmd, arg)
+		}
+		stage.Args = args
+		if stage.Redirects != nil {
+			redirects := make([]Redirect, len(stage.Redirects))
+			for i, redirect := range stage.Redirects {
+				redirects[i] = Redirect{Op: redirect.Op, Target: guess("", redirect.Target)}
+			}
+			stage.Redirects = redirects
+		}
+		return stage
+	}
+
+	first := guessStage(Stage{Cmd: result.Cmd, Args: result.Args, Redirects: result.Redirects})
+	result.Args, result.Redirects = first.Args, first.Redirects
+	if result.Pipeline != nil {
+		pipeline := make([]Stage, len(result.Pipeline))
+		for i, stage := range result.Pipeline {
+			pipeline[i] = guessStage(stage)
+		}
+		result.Pipeline = pipeline
+	}
+	return result
+}
+
+// pathWords mark a placeholder whose value is a file or directory.
+var pathWords = []string{"path", "file", "dir", "folder", "dest", "src", "source", "target", "output", "input"}
+
+// IsPath guesses from the name and description whether the placeholder
+// stands for a file or directory.
+func (p Placeholder) IsPath() bool {
+	text := strings.ToLower(p.Name + " " + p.Description)
+	for _, word := range pathWords {
+		if strings.Contains(text, word) {
+			return true
+		}
+	}
+	return false
+}
+
+// Fill returns result with the placeholders in values replaced. Values
+// are taken literally, except for a leading ~/: the command line that
+// runs quotes them, so that spaces, $ or * in a value mean nothing to
+// the shell.
+func (r Result) Fill(values map[string]string) Result {
+	expanded := make(map[string]string, len(values))
+	for name, value := range values {
+		expanded[name] = expandHome(value)
+	}
+	replace := func(quote func(string) string) func(string) string {
+		return func(text string) string {
+			return ReplacePlaceholders(text, func(name string) string {
+				if value, ok := expanded[name]; ok {
+					return quote(value)
+				}
+				return "{{" + name + "}}"
+			})
+		}
+	}
+
+	d := DialectForShell(UserShell())
+	line := r.CommandLine()
+	filled := mapResultText(r, replace(func(value string) string { return value }))
+	filled.Line = replace(func(value string) string { return quoteWord(d, value, false, false) })(line)
+	filled.Placeholders = slices.DeleteFunc(slices.Clone(filled.Placeholders), func(placeholder Placeholder) bool {
+		_, ok := expanded[placeholder.Name]
+		return ok
+	})
+	return filled
+}
+
+func expandHome(value string) string {
+	if value != "~" && !strings.HasPrefix(value, "~/") {
+		return value
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return value
+	}
+	return home + value[1:]
+}
+
+// FillPlaceholders fills in the placeholders of result and judges the
+// command by the safety policy again, since a value can make it riskier.
+func (m *Model) FillPlaceholders(result Result, values map[string]string) (Result, error) {
+	policy, err := NewPolicy(m.Config.SafetyPolicy())
+	if err != nil {
+		return result, err
+	}
+	filled := result.Fill(values)
+	if names := filled.PlaceholderNames(); len(names) > 0 {
+		return result, fmt.Errorf("no value for <%s>", strings.Join(names, ">, <"))
+	}
+	filled.Decision = policy.Evaluate(filled)
+	return filled, nil
+}
@@ -0,0 +1,218 @@
+package model
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+const maxPlanSteps = 8
+
+// planAttempts is the retry policy for plans, which need more room for
+// output than single commands.
+var planAttempts = []generationAttempt{
+	{maxResults: maxPlanSteps, nPredict: maxOutputTokens + 600, temperature: 0.3},
+	{maxResults: maxPlanSteps, nPredict: maxOutputTokens + 800, temperature: 0.1},
+	{maxResults: maxPlanSteps / 2, nPredict: maxOutputTokens + 800, temperature: 0},
+}
+
+// planGrammar is the GBNF grammar for a JSON array of steps: a title, the
+// fields of a command, the steps it depends on and its expected outcome.
+const planGrammar = `root ::= ws "[" ws step (ws "," ws step)* ws "]" ws
+step ::= "{" ws "\"title\"" ws ":" ws string ws "," ws fields ws "," ws "\"depends_on\"" ws ":" ws steprefs ws "," ws "\"expect\"" ws ":" ws string ws "}"
+steprefs ::= "[" ws (stepref (ws "," ws stepref)*)? ws "]"
+stepref ::= [1-9] [0-9]?
+` + commandGrammarRules
+
+// Step is one command of a plan. DependsOn holds the numbers, counting
+// from 1, of the earlier steps it needs; Expect is what should be true
+// once it succeeded.
+type Step struct {
+	Title string `json:"title"`
+	Result
+	DependsOn []int  `json:"depends_on,omitempty"`
+	Expect    string `json:"expect,omitempty"`
+}
+
+// Plan is the ordered steps that together do Task.
+type Plan struct {
+	Task  string
+	Steps []Step
+}
+
+func parsePlan(raw string) ([]Step, error) {
+	return parseArray(raw, func(step Step) bool {
+		return strings.TrimSpace(step.Cmd) != ""
+	})
+}
+
+// Plan asks for the steps that do userInput. Like Ask, every step is
+// judged by the safety policy and secrets in the task never reach the
+// model. Steps the organisation policy forbids are kept, blocked, so that
+// the numbering the steps depend on holds.
+func (m *Model) Plan(userInput string) (*Plan, error) {
+	policy, err := NewPolicy(m.Config.SafetyPolicy())
+	if err != nil {
+		return nil, err
+	}
+	m.Secrets = NewRedactor()
+	redacted := m.Secrets.Redact(userInput)
+	promptContext := m.Secrets.redactContext(m.Context(redacted))
+	ctx, cancel := context.WithTimeout(context.Background(), 180*time.Second)
+	defer cancel()
+	reference := buildManReference(ctx, redacted, m.Config.Index, m.Config.References)
+	builder := NewPromptBuilder(templateFor(m.Config.Model, m.Config.Prompt))
+	builder.Plan = true
+
+	build := func(pb PromptBuilder) string {
+		return pb.Build(redacted, promptContext, reference, nil)
+	}
+	steps, err := generateWith(ctx, m, planGrammar, planAttempts, builder, build, parsePlan)
+	if err != nil {
+		return nil, err
+	}
+
+	if !m.Config.Validation.Disabled {
+		// Steps are checked one by one; unlike suggestions they must
+		// keep their order.
+		index := loadReferenceIndex(ctx, m.Config.Index)
+		validator := NewValidator(index)
+		validateCtx, cancelValidate := context.WithTimeout(ctx, validationTimeout)
+		for i := range steps {
+			warnings := validator.Validate(validateCtx, steps[i].Result)
+			steps[i].Warnings = slices.DeleteFunc(warnings, func(warning string) bool {
+				return createdEarlier(steps[:i], warning)
+			})
+		}
+		cancelValidate()
+	}
+	for i := range steps {
+		step := &steps[i]
+		step.Title = m.Secrets.Restore(step.Title)
+		step.Expect = m.Secrets.Restore(step.Expect)
+		step.Result = guessPlaceholders(m.Secrets.RestoreResult(step.Result), userInput)
+		step.Decision = policy.Evaluate(step.Result)
+		// A step can only depend on the ones before it.
+		step.DependsOn = slices.DeleteFunc(step.DependsOn, func(n int) bool { return n < 1 || n > i })
+	}
+	return &Plan{Task: userInput, Steps: steps}, nil
+}
+
+// createdEarlier reports whether warning is about a command that one of
+// steps installs or creates, such as jq after apt install jq or
+// .venv/bin/pip after python3 -m venv .venv.
+func createdEarlier(steps []Step, warning string) bool {
+	for _, step := range steps {
+		for _, stage := range step.Stages() {
+			for _, arg := range stage.Args {
+				arg = strings.TrimSuffix(arg, "/")
+				if arg == "" || isFlagLike(arg) {
+					continue
+				}
+				if warning == notInstalledProblem(arg) ||
+					strings.HasPrefix(warning, arg+"/") && strings.HasSuffix(warning, notInstalledProblem("")) {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// EditStep replaces the command of step i with line, as the user typed
+// it, and judges it again. The placeholders still in use are kept.
+func (m *Model) EditStep(plan *Plan, i int, line string) error {
+	policy, err := NewPolicy(m.Config.SafetyPolicy())
+	if err != nil {
+		return err
+	}
+	result, err := ParseCommandLine(line)
+	if err != nil {
+		return err
+	}
+	step := &plan.Steps[i]
+	result.Risk = step.Risk
+	result.RequiresRoot = filepath.Base(result.Cmd) == "sudo" || step.RequiresRoot
+	result.Explain = step.Explain
+	used := result.PlaceholderNames()
+	for _, placeholder := range step.Placeholders {
+		if slices.Contains(used, placeholder.Name) {
+			result.Placeholders = append(result.Placeholders, placeholder)
+		}
+	}
+	result.Decision = policy.Evaluate(result)
+	step.Result = result
+	return nil
+}
+
+// Script renders the plan as a strict bash script that runs the steps in
+// order and stops at the first that fails. Placeholders become options of
+// the script, with usage text; blocked steps are commented out.
+func (p *Plan) Script() string {
+	var builder strings.Builder
+	builder.WriteString("#!/usr/bin/env bash\n")
+	builder.WriteString(scriptComment(p.Task))
+	builder.WriteString("#\n# Generated by clai; review it before running.\n")
+	builder.WriteString("set -euo pipefail\n")
+	writeScriptOptions(&builder, p.Task, p.placeholders())
+
+	for i, step := range p.Steps {
+		builder.WriteString("\n")
+		builder.WriteString(scriptComment(fmt.Sprintf("Step %d: %s", i+1, step.Title)))
+		if step.Explain != "" {
+			builder.WriteString(scriptComment(step.Explain))
+		}
+		if len(step.DependsOn) > 0 {
+			needs := make([]string, len(step.DependsOn))
+			for j, n := range step.DependsOn {
+				needs[j] = fmt.Sprint(n)
+			}
+			builder.WriteString(scriptComment("Needs step " + strings.Join(needs, ", ")))
+		}
+		if step.Expect != "" {
+			builder.WriteString(scriptComment("Expect: " + step.Expect))
+		}
+		if step.Decision.Blocked() {
+			// Left in for the record, but never run.
+			builder.WriteString(scriptComment("Blocked by policy: " + strings.Join(step.Decision.Reasons, "; ")))
+			builder.WriteString(scriptComment(scriptLine(step.Result)))
+			continue
+		}
+		fmt.Fprintf(&builder, "echo %s >&2\n", quoteLiteral(DialectBash, fmt.Sprintf("==> %d. %s", i+1, step.Title)))
+		builder.WriteString(scriptLine(step.Result) + "\n")
+	}
+	return builder.String()
+}
+
+// placeholders returns the placeholders the steps use, in order of first
+// use. A placeholder can be described by a step other than the first to
+// use it.
+func (p *Plan) placeholders() []Placeholder {
+	declared := make(map[string]Placeholder)
+	for _, step := range p.Steps {
+		for _, placeholder := range step.Placeholders {
+			if _, ok := declared[placeholder.Name]; !ok {
+				declared[placeholder.Name] = placeholder
+			}
+		}
+	}
+	var placeholders []Placeholder
+	seen := make(map[string]struct{})
+	for _, step := range p.Steps {
+		for _, name := range step.PlaceholderNames() {
+			if _, ok := seen[scriptVariable(name)]; ok {
+				continue
+			}
+			seen[scriptVariable(name)] = struct{}{}
+			placeholder, ok := declared[name]
+			if !ok {
+				placeholder = Placeholder{Name: name}
+			}
+			placeholders = append(placeholders, placeholder)
+		}
+	}
+	return placeholders
+}
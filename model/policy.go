@@ -0,0 +1,468 @@
+package model
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// PolicyAction is what happens to a suggestion that matches a rule, from
+// least to most strict.
+type PolicyAction string
+
+const (
+	PolicyAllow   PolicyAction = "allow"
+	PolicyWarn    PolicyAction = "warn"
+	PolicyConfirm PolicyAction = "confirm"
+	PolicyDeny    PolicyAction = "deny"
+)
+
+var policyStrictness = map[PolicyAction]int{
+	PolicyAllow:   0,
+	PolicyWarn:    1,
+	PolicyConfirm: 2,
+	PolicyDeny:    3,
+}
+
+// PolicyRule matches a suggestion when one of its commands matches every
+// criterion given: the command name, one of the flags and one of the
+// arguments or redirect targets. Pattern, if set, must also match the
+// whole command line. Names and arguments are shell patterns.
+type PolicyRule struct {
+	Name     string       `yaml:"name"`
+	Commands []string     `yaml:"commands,omitempty"`
+	Flags    []string     `yaml:"flags,omitempty"`
+	Args     []string     `yaml:"args,omitempty"`
+	Pattern  string       `yaml:"pattern,omitempty"`
+	Action   PolicyAction `yaml:"action"`
+	Message  string       `yaml:"message,omitempty"`
+
+	// Locked rules come from the organisation policy; the user's rules
+	// cannot replace them.
+	Locked bool `yaml:"-"`
+}
+
+// PolicyConfig adds rules to the built-in ones. A rule with the name of a
+// built-in rule replaces it, so a built-in can be relaxed or tightened.
+type PolicyConfig struct {
+	DisableBuiltin bool         `yaml:"disable_builtin,omitempty"`
+	Rules          []PolicyRule `yaml:"rules,omitempty"`
+}
+
+// PolicyDecision is the outcome for one suggestion.
+type PolicyDecision struct {
+	Action  PolicyAction
+	Reasons []string
+
+	// Command is the name of the command the strictest rule matched, with
+	// wrappers such as sudo removed: rm for sudo rm -rf build.
+	Command string
+
+	// Forbidden is set when a locked rule denies the suggestion, which is
+	// then not shown at all.
+	Forbidden bool
+}
+
+// Blocked reports whether the suggestion may not be run.
+func (d PolicyDecision) Blocked() bool {
+	return d.Action == PolicyDeny
+}
+
+// NeedsConfirmation reports whether running requires typed confirmation.
+func (d PolicyDecision) NeedsConfirmation() bool {
+	return d.Action == PolicyConfirm
+}
+
+// systemPaths are arguments no bulk delete or permission change should
+// touch: the root, system directories and home, and everything in them.
+// A \* is a literal star, as typed by the model.
+var systemPaths = func() []string {
+	var paths []string
+	for _, dir := range []string{
+		"", "/bin", "/boot", "/dev", "/etc", "/home", "/lib", "/lib64", "/opt",
+		"/proc", "/root", "/sbin", "/sys", "/usr", "/var", "~", "$HOME", "${HOME}",
+	} {
+		if dir != "" {
+			paths = append(paths, dir)
+		}
+		paths = append(paths, dir+"/\\*")
+	}
+	return append(paths, "/")
+}()
+
+var builtinPolicyRules = []PolicyRule{
+	{Name: "rm-system-path", Commands: []string{"rm"}, Args: systemPaths, Action: PolicyDeny,
+		Message: "deletes a system or home directory"},
+	{Name: "rm-recursive", Commands: []string{"rm"}, Flags: []string{"-r", "-R", "--recursive"}, Action: PolicyConfirm,
+		Message: "recursively deletes files"},
+	{Name: "recursive-permissions-system-path", Commands: []string{"chmod", "chown", "chgrp"}, Flags: []string{"-R", "--recursive"}, Args: systemPaths, Action: PolicyDeny,
+		Message: "changes permissions of a whole system or home directory"},
+	{Name: "world-writable", Commands: []string{"chmod"}, Args: []string{"777", "a+rwx", "o+w", "a+w"}, Action: PolicyWarn,
+		Message: "makes files writable by every user"},
+	{Name: "write-block-device", Commands: []string{"dd"}, Args: []string{"of=/dev/*"}, Action: PolicyConfirm,
+		Message: "writes directly to a disk"},
+	{Name: "redirect-block-device", Pattern: `>\s*'?/dev/(sd|nvme|hd|vd|xvd|mmcblk|disk)`, Action: PolicyDeny,
+		Message: "overwrites a disk device"},
+	{Name: "format-disk", Commands: []string{"mkfs", "mkfs.*", "mke2fs", "wipefs", "sfdisk", "shred"}, Action: PolicyConfirm,
+		Message: "formats, partitions or wipes storage"},
+	{Name: "find-delete", Commands: []string{"find"}, Args: []string{"-delete", "rm", "-exec"}, Action: PolicyConfirm,
+		Message: "deletes or runs a command on every file found"},
+	{Name: "git-force-push", Commands: []string{"git"}, Flags: []string{"--force", "-f", "--mirror"}, Args: []string{"push"}, Action: PolicyConfirm,
+		Message: "rewrites history on the remote"},
+	{Name: "git-force-push-refspec", Commands: []string{"git"}, Pattern: `\bgit\b[^;&|]*\spush\b[^;&|]*\s'?\+[^\s']`, Action: PolicyConfirm,
+		Message: "rewrites history on the remote"},
+	{Name: "git-discard-changes", Commands: []string{"git"}, Flags: []string{"--hard", "-fd", "-fdx", "-f"}, Args: []string{"reset", "clean", "checkout"}, Action: PolicyWarn,
+		Message: "discards local changes that cannot be recovered"},
+	{Name: "power", Commands: []string{"shutdown", "reboot", "halt", "poweroff"}, Action: PolicyConfirm,
+		Message: "shuts down or restarts the machine"},
+	{Name: "kill-everything", Pattern: `\bkill(\s+-\w+)*\s+-1\s*($|[;&|])`, Action: PolicyDeny,
+		Message: "kills every process you own"},
+	{Name: "pipe-to-shell", Pattern: `\b(curl|wget)\b.*\|\s*(sudo\s+)?(ba|z|da|k)?sh\b`, Action: PolicyConfirm,
+		Message: "runs a script downloaded from the internet"},
+	{Name: "fork-bomb", Pattern: `:\(\)\s*\{.*:\|:`, Action: PolicyDeny,
+		Message: "fork bomb"},
+	{Name: "delete-cluster-resources", Commands: []string{"kubectl"}, Args: []string{"delete"}, Action: PolicyConfirm,
+		Message: "deletes cluster resources"},
+	{Name: "docker-prune", Commands: []string{"docker"}, Args: []string{"prune", "rm", "rmi"}, Action: PolicyWarn,
+		Message: "removes containers, images or volumes"},
+}
+
+type compiledRule struct {
+	PolicyRule
+	pattern *regexp.Regexp
+}
+
+// Policy evaluates suggestions against a rule set. It does no I/O, so it
+// can be exercised with literal Results.
+type Policy struct {
+	rules []compiledRule
+}
+
+// NewPolicy combines the built-in rules with the configured ones.
+func NewPolicy(cfg PolicyConfig) (*Policy, error) {
+	var rules []PolicyRule
+	if !cfg.DisableBuiltin {
+		rules = append(rules, builtinPolicyRules...)
+	}
+	for _, rule := range cfg.Rules {
+		replaced := false
+		for i := range rules {
+			if rule.Name != "" && rules[i].Name == rule.Name && !rules[i].Locked {
+				rules[i] = rule
+				replaced = true
+			}
+		}
+		if !replaced {
+			rules = append(rules, rule)
+		}
+	}
+
+	policy := &Policy{}
+	for _, rule := range rules {
+		if _, ok := policyStrictness[rule.Action]; !ok {
+			return nil, fmt.Errorf("policy rule %q: unknown action %q", rule.Name, rule.Action)
+		}
+		compiled := compiledRule{PolicyRule: rule}
+		if rule.Pattern != "" {
+			pattern, err := regexp.Compile(rule.Pattern)
+			if err != nil {
+				return nil, fmt.Errorf("policy rule %q: %w", rule.Name, err)
+			}
+			compiled.pattern = pattern
+		}
+		policy.rules = append(policy.rules, compiled)
+	}
+	return policy, nil
+}
+
+// maxShellNesting is how deep scripts handed to a shell, as in
+// sh -c 'sh -c ...', are followed.
+const maxShellNesting = 4
+
+// shellCommands run the script given with -c.
+var shellCommands = map[string]struct{}{
+	"sh": {}, "bash": {}, "zsh": {}, "dash": {}, "ksh": {}, "mksh": {}, "ash": {}, "fish": {},
+}
+
+// policyUnit is a command line the rules are matched against: the
+// suggestion itself, or a script one of its commands hands to a shell.
+// Its stages have their wrappers removed.
+type policyUnit struct {
+	line   string
+	stages []Stage
+}
+
+// Evaluate returns the strictest action of the rules result matches, with
+// the reason of each. Without a match the decision is allow. Wrappers
+// such as sudo and xargs are looked through, and scripts run with sh -c
+// or env -S are judged like the rest of the line. Scripts that cannot be
+// parsed and command substitutions need confirmation, since what they
+// run is not known.
+func (p *Policy) Evaluate(result Result) PolicyDecision {
+	decision := PolicyDecision{Action: PolicyAllow}
+	add := func(action PolicyAction, command, reason string) {
+		if !slices.Contains(decision.Reasons, reason) {
+			decision.Reasons = append(decision.Reasons, reason)
+		}
+		if policyStrictness[action] > policyStrictness[decision.Action] {
+			decision.Action = action
+			decision.Command = command
+		}
+	}
+
+	units, unparsed := policyUnits(result.Render(DialectPOSIX), result.Stages(), 0)
+	for _, rule := range p.rules {
+		for _, unit := range units {
+			command, ok := rule.match(unit)
+			if !ok {
+				continue
+			}
+			reason := rule.Message
+			if reason == "" {
+				reason = "matches policy rule " + rule.Name
+			}
+			add(rule.Action, command, reason)
+			if rule.Locked && rule.Action == PolicyDeny {
+				decision.Forbidden = true
+			}
+			break
+		}
+	}
+	if unparsed != "" {
+		add(PolicyConfirm, unparsed, "runs a shell script that cannot be checked")
+	}
+	for _, unit := range units {
+		if command := substitutionCommand(unit); command != "" {
+			add(PolicyConfirm, command, "runs the commands in a $(...) or `...` substitution")
+			break
+		}
+	}
+	return decision
+}
+
+// policyUnits returns the unit of line and stages, followed by those of
+// the scripts its commands hand to a shell. It also returns the name of
+// the shell given a script that could not be parsed, if there is one.
+func policyUnits(line string, stages []Stage, depth int) ([]policyUnit, string) {
+	unit := policyUnit{line: line}
+	var nested []policyUnit
+	unparsed := ""
+	for i, stage := range stages {
+		command, args := unwrapCommand(stage.Cmd, stage.Args)
+		if i > 0 && path.Base(stage.Cmd) == "xargs" && command != stage.Cmd && path.Base(stages[i-1].Cmd) == "find" {
+			// find / | xargs rm: the files come from where find looks.
+			args = append(slices.Clip(args), findStartingPoints(stages[i-1].Args)...)
+		}
+		if script, ok := shellScript(command, args); ok {
+			parsed, err := ParseCommandLine(script)
+			switch {
+			case depth >= maxShellNesting || err != nil && strings.TrimSpace(script) != "":
+				if unparsed == "" {
+					unparsed = path.Base(command)
+				}
+			case err == nil:
+				units, scriptUnparsed := policyUnits(parsed.Line, parsed.Stages(), depth+1)
+				nested = append(nested, units...)
+				if unparsed == "" {
+					unparsed = scriptUnparsed
+				}
+			}
+		}
+		unit.stages = append(unit.stages, Stage{Op: stage.Op, Cmd: command, Args: args, Redirects: stage.Redirects})
+	}
+	return append([]policyUnit{unit}, nested...), unparsed
+}
+
+// match reports whether the rule matches unit and returns the name of
+// the command it matched. A rule with only a pattern matches the line,
+// which is named after its first command.
+func (r compiledRule) match(unit policyUnit) (string, bool) {
+	if r.pattern != nil && !r.pattern.MatchString(unit.line) {
+		return "", false
+	}
+	if len(r.Commands) == 0 && len(r.Flags) == 0 && len(r.Args) == 0 {
+		if r.pattern == nil || len(unit.stages) == 0 {
+			return "", r.pattern != nil
+		}
+		return path.Base(unit.stages[0].Cmd), true
+	}
+	for _, stage := range unit.stages {
+		if len(r.Commands) > 0 && !matchesAny(r.Commands, path.Base(stage.Cmd)) {
+			continue
+		}
+		if len(r.Flags) > 0 && !hasAnyFlag(stage.Args, r.Flags) {
+			continue
+		}
+		if len(r.Args) > 0 && !hasAnyArg(stage.Args, stage.Redirects, r.Args) {
+			continue
+		}
+		return path.Base(stage.Cmd), true
+	}
+	return "", false
+}
+
+// unwrapCommand skips wrappers such as sudo and xargs, so that
+// sudo rm -rf / is judged as rm -rf /.
+func unwrapCommand(command string, args []string) (string, []string) {
+	for {
+		if _, ok := wrapperCommands[path.Base(command)]; !ok {
+			return command, args
+		}
+		if _, ok := shellScript(command, args); ok {
+			// env -S runs a command line, not its next argument.
+			return command, args
+		}
+		next := wrappedCommand(command, args)
+		if next < 0 {
+			return command, args
+		}
+		command, args = args[next], args[next+1:]
+	}
+}
+
+// shellScript returns the script command runs as a command line of its
+// own: the argument of sh -c, or the string env -S splits into words.
+func shellScript(command string, args []string) (string, bool) {
+	name := path.Base(command)
+	if name == "env" {
+		for i, arg := range args {
+			switch {
+			case (arg == "-S" || arg == "--split-string") && i+1 < len(args):
+				return args[i+1], true
+			case strings.HasPrefix(arg, "--split-string="):
+				return strings.TrimPrefix(arg, "--split-string="), true
+			case strings.HasPrefix(arg, "-S") && len(arg) > 2:
+				return arg[2:], true
+			}
+		}
+		return "", false
+	}
+	if _, ok := shellCommands[name]; !ok {
+		return "", false
+	}
+	// The script is the first operand; -c, alone or bundled as in -ec,
+	// says it is a script and not a file.
+	hasC := false
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		switch {
+		case arg == "-o" || arg == "+o" || arg == "-O" || arg == "+O":
+			// bash -o pipefail: the option name is not the script.
+			i++
+		case arg == "--":
+			if i+1 < len(args) {
+				return args[i+1], hasC
+			}
+			return "", false
+		case strings.HasPrefix(arg, "-") && !strings.HasPrefix(arg, "--") && len(arg) > 1:
+			hasC = hasC || strings.ContainsRune(arg[1:], 'c')
+		case strings.HasPrefix(arg, "-") || strings.HasPrefix(arg, "+"):
+		default:
+			return arg, hasC
+		}
+	}
+	return "", false
+}
+
+// findStartingPoints returns the directories find searches, the operands
+// before its first expression.
+func findStartingPoints(args []string) []string {
+	var points []string
+	for _, arg := range args {
+		switch {
+		case arg == "-H" || arg == "-L" || arg == "-P":
+		case arg == "" || arg[0] == '-' || arg[0] == '(' || arg[0] == '!':
+			return points
+		default:
+			points = append(points, arg)
+		}
+	}
+	return points
+}
+
+// substitutionCommand returns the name of the command in unit with an
+// argument that runs a command of its own, or "" if there is none.
+// Programs for awk or sed are never expanded by the shell, so their $( is
+// left alone.
+func substitutionCommand(unit policyUnit) string {
+	for _, stage := range unit.stages {
+		if _, ok := programCommands[path.Base(stage.Cmd)]; ok {
+			continue
+		}
+		texts := append([]string{stage.Cmd}, stage.Args...)
+		for _, redirect := range stage.Redirects {
+			texts = append(texts, redirect.Target)
+		}
+		for _, text := range texts {
+			if strings.Contains(text, "$(") || strings.Contains(text, "`") {
+				return path.Base(stage.Cmd)
+			}
+		}
+	}
+	return ""
+}
+
+func matchesAny(patterns []string, value string) bool {
+	for _, pattern := range patterns {
+		if pattern == value {
+			return true
+		}
+		if ok, _ := path.Match(pattern, value); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// hasAnyFlag finds the flags in args, looking inside bundles like -rf for
+// single letter flags.
+func hasAnyFlag(args, flags []string) bool {
+	for _, arg := range args {
+		name := flagName(arg)
+		for _, flag := range flags {
+			if name == flag {
+				return true
+			}
+			if len(flag) == 2 && flag[0] == '-' && flag[1] != '-' && isShortBundle(name) && strings.ContainsRune(name[1:], rune(flag[1])) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func isShortBundle(arg string) bool {
+	if len(arg) < 3 || arg[0] != '-' || arg[1] == '-' || len(arg) > 6 {
+		return false
+	}
+	for _, r := range arg[1:] {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z') {
+			return false
+		}
+	}
+	return true
+}
+
+func hasAnyArg(args []string, redirects []Redirect, patterns []string) bool {
+	values := append([]string{}, args...)
+	for _, redirect := range redirects {
+		if redirect.Target != "" {
+			values = append(values, redirect.Target)
+		}
+	}
+	for _, value := range values {
+		cleaned := value
+		if len(cleaned) > 1 {
+			cleaned = strings.TrimRight(cleaned, "/")
+			if cleaned == "" {
+				cleaned = "/"
+			}
+		}
+		if matchesAny(patterns, value) || matchesAny(patterns, cleaned) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,136 @@
+package model
+
+import "testing"
+
+func TestPolicyEvaluate(t *testing.T) {
+	policy, err := NewPolicy(PolicyConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name   string
+		result Result
+		want   PolicyAction
+	}{
+		{"read only", Result{Cmd: "ls", Args: []string{"-la"}}, PolicyAllow},
+		{"rm in project", Result{Cmd: "rm", Args: []string{"build.log"}}, PolicyAllow},
+		{"rm root", Result{Cmd: "rm", Args: []string{"-rf", "/"}}, PolicyDeny},
+		{"rm home contents", Result{Cmd: "rm", Args: []string{"-rf", "~/*"}}, PolicyDeny},
+		{"rm system dir with slash", Result{Cmd: "rm", Args: []string{"-r", "/etc/"}}, PolicyDeny},
+		{"rm recursive", Result{Cmd: "rm", Args: []string{"-rf", "build"}}, PolicyConfirm},
+		{"rm recursive long", Result{Cmd: "rm", Args: []string{"--recursive", "build"}}, PolicyConfirm},
+		{"sudo rm root", Result{Cmd: "sudo", Args: []string{"-u", "root", "rm", "-rf", "/"}}, PolicyDeny},
+		{"sudo empty argument", Result{Cmd: "sudo", Args: []string{"", "rm"}}, PolicyAllow},
+		{"env empty argument", Result{Cmd: "env", Args: []string{"", "", "rm", "-rf", "/"}}, PolicyDeny},
+		{"wrapper without command", Result{Cmd: "sudo", Args: []string{"-u"}}, PolicyAllow},
+		{"xargs rm root", Result{Cmd: "xargs", Args: []string{"rm", "-rf", "/"}}, PolicyDeny},
+		{"xargs options", Result{Cmd: "xargs", Args: []string{"-0", "-I", "{}", "rm", "-rf", "{}"}}, PolicyConfirm},
+		{"find root into xargs rm", Result{
+			Cmd: "find", Args: []string{"/", "-name", "x"},
+			Pipeline: []Stage{{Op: "|", Cmd: "xargs", Args: []string{"rm", "-rf"}}},
+		}, PolicyDeny},
+		{"find here into xargs rm", Result{
+			Cmd: "find", Args: []string{".", "-name", "*.pyc"},
+			Pipeline: []Stage{{Op: "|", Cmd: "xargs", Args: []string{"rm"}}},
+		}, PolicyAllow},
+		{"sh -c rm root", Result{Cmd: "sh", Args: []string{"-c", "rm -rf /"}}, PolicyDeny},
+		{"bash -ec in pipeline", Result{Cmd: "bash", Args: []string{"-o", "pipefail", "-ec", "cd /tmp && rm -rf /etc"}}, PolicyDeny},
+		{"nested shells", Result{Cmd: "sudo", Args: []string{"sh", "-c", "bash -c 'rm -rf /'"}}, PolicyDeny},
+		{"sh -c harmless", Result{Cmd: "sh", Args: []string{"-c", "ls | wc -l"}}, PolicyAllow},
+		{"sh -c unparsable", Result{Cmd: "sh", Args: []string{"-c", "(cd /tmp; ls)"}}, PolicyConfirm},
+		{"sh runs a file", Result{Cmd: "sh", Args: []string{"install.sh"}}, PolicyAllow},
+		{"env -S", Result{Cmd: "env", Args: []string{"-S", "rm -rf /"}}, PolicyDeny},
+		{"command substitution", Result{Cmd: "rm", Args: []string{"$(cat files.txt)"}}, PolicyConfirm},
+		{"backticks", Result{Cmd: "echo", Args: []string{"`whoami`"}}, PolicyConfirm},
+		{"awk program is not substitution", Result{Cmd: "awk", Args: []string{"{print $(NF-1)}", "data.txt"}}, PolicyAllow},
+		{"recursive chmod system path", Result{Cmd: "chmod", Args: []string{"-R", "755", "/usr"}}, PolicyDeny},
+		{"world writable", Result{Cmd: "chmod", Args: []string{"777", "script.sh"}}, PolicyWarn},
+		{"dd to disk", Result{Cmd: "dd", Args: []string{"if=image.iso", "of=/dev/sdb"}}, PolicyConfirm},
+		{"redirect to disk", Result{Cmd: "cat", Args: []string{"image.iso"}, Redirects: []Redirect{{Op: ">", Target: "/dev/sda"}}}, PolicyDeny},
+		{"mkfs", Result{Cmd: "mkfs.ext4", Args: []string{"/dev/sdb1"}}, PolicyConfirm},
+		{"find delete", Result{Cmd: "find", Args: []string{".", "-name", "*.tmp", "-delete"}}, PolicyConfirm},
+		{"git force push", Result{Cmd: "git", Args: []string{"push", "--force"}}, PolicyConfirm},
+		{"git force push refspec", Result{Cmd: "git", Args: []string{"push", "origin", "+main"}}, PolicyConfirm},
+		{"git force push refspec with destination", Result{Cmd: "git", Args: []string{"push", "origin", "+HEAD:refs/heads/main"}}, PolicyConfirm},
+		{"git push", Result{Cmd: "git", Args: []string{"-C", "site", "push", "origin", "main"}, Pipeline: []Stage{{Op: "&&", Cmd: "echo", Args: []string{"+1"}}}}, PolicyAllow},
+		{"git reset hard", Result{Cmd: "git", Args: []string{"reset", "--hard"}}, PolicyWarn},
+		{"reboot", Result{Cmd: "sudo", Args: []string{"reboot"}}, PolicyConfirm},
+		{"kill everything", Result{Cmd: "kill", Args: []string{"-9", "-1"}}, PolicyDeny},
+		{"curl into shell", Result{
+			Cmd: "curl", Args: []string{"-fsSL", "https://get.example.com"},
+			Pipeline: []Stage{{Op: "|", Cmd: "sh"}},
+		}, PolicyConfirm},
+		{"kubectl delete", Result{Cmd: "kubectl", Args: []string{"delete", "pod", "web"}}, PolicyConfirm},
+		{"docker prune", Result{Cmd: "docker", Args: []string{"system", "prune"}}, PolicyWarn},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			decision := policy.Evaluate(test.result)
+			if decision.Action != test.want {
+				t.Errorf("Evaluate(%s) = %s %q, want %s", test.result.Render(DialectPOSIX), decision.Action, decision.Reasons, test.want)
+			}
+		})
+	}
+}
+
+func TestPolicyDecisionCommand(t *testing.T) {
+	policy, err := NewPolicy(PolicyConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name   string
+		result Result
+		want   string
+	}{
+		{"plain", Result{Cmd: "rm", Args: []string{"-rf", "build"}}, "rm"},
+		{"sudo", Result{Cmd: "sudo", Args: []string{"-u", "root", "rm", "-rf", "build"}}, "rm"},
+		{"xargs", Result{Cmd: "xargs", Args: []string{"-0", "rm", "-r"}}, "rm"},
+		{"sh -c", Result{Cmd: "sh", Args: []string{"-c", "cd /srv && git push -f"}}, "git"},
+		{"later stage", Result{Cmd: "ls", Pipeline: []Stage{{Op: "&&", Cmd: "/usr/bin/sudo", Args: []string{"/sbin/reboot"}}}}, "reboot"},
+		{"pattern", Result{Cmd: "curl", Args: []string{"-fsSL", "https://get.example.com"}, Pipeline: []Stage{{Op: "|", Cmd: "sh"}}}, "curl"},
+		{"unparsable script", Result{Cmd: "sudo", Args: []string{"bash", "-c", "(cd /tmp; ls)"}}, "bash"},
+		{"substitution", Result{Cmd: "sudo", Args: []string{"rm", "$(cat files.txt)"}}, "rm"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			decision := policy.Evaluate(test.result)
+			if !decision.NeedsConfirmation() || decision.Command != test.want {
+				t.Errorf("Evaluate(%s) = %s for %q, want confirm for %q", test.result.Render(DialectPOSIX), decision.Action, decision.Command, test.want)
+			}
+		})
+	}
+}
+
+func TestPolicyConfigRules(t *testing.T) {
+	policy, err := NewPolicy(PolicyConfig{Rules: []PolicyRule{
+		{Name: "rm-recursive", Commands: []string{"rm"}, Flags: []string{"-r"}, Action: PolicyAllow},
+		{Name: "no-terraform-destroy", Commands: []string{"terraform"}, Args: []string{"destroy"}, Action: PolicyDeny},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decision := policy.Evaluate(Result{Cmd: "rm", Args: []string{"-rf", "build"}}); decision.Action != PolicyAllow {
+		t.Errorf("replaced rule: got %s, want allow", decision.Action)
+	}
+	if decision := policy.Evaluate(Result{Cmd: "terraform", Args: []string{"destroy"}}); decision.Action != PolicyDeny {
+		t.Errorf("added rule: got %s, want deny", decision.Action)
+	}
+
+	relaxed, err := NewPolicy(PolicyConfig{Rules: []PolicyRule{
+		{Name: "rm-system-path", Commands: []string{"rm"}, Action: PolicyAllow},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decision := relaxed.Evaluate(Result{Cmd: "rm", Args: []string{"/"}}); decision.Action != PolicyAllow {
+		t.Errorf("relaxed built-in rule: got %s, want allow", decision.Action)
+	}
+
+	if _, err := NewPolicy(PolicyConfig{Rules: []PolicyRule{{Name: "bad", Action: "maybe"}}}); err == nil {
+		t.Error("unknown action: got no error")
+	}
+	if _, err := NewPolicy(PolicyConfig{Rules: []PolicyRule{{Name: "bad", Pattern: "(", Action: PolicyDeny}}}); err == nil {
+		t.Error("invalid pattern: got no error")
+	}
+}
@@ -0,0 +1,357 @@
+package model
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	previewTimeout     = 30 * time.Second
+	maxPreviewBytes    = 200 << 20
+	maxPreviewFiles    = 20000
+	maxPreviewOutput   = 16 << 10
+	maxPreviewDiff     = 4 << 10
+	maxPreviewDiffs    = 10
+	previewWorkDirName = "work"
+)
+
+// PreviewReport is what a command did to a copy of the working directory.
+type PreviewReport struct {
+	Created  []string
+	Modified []string
+	Deleted  []string
+	// Diffs holds unified diffs of modified text files, by path.
+	Diffs    map[string]string
+	Stdout   string
+	Stderr   string
+	ExitCode int
+}
+
+// Changed reports whether the command changed any file.
+func (r *PreviewReport) Changed() bool {
+	return len(r.Created)+len(r.Modified)+len(r.Deleted) > 0
+}
+
+type fileState struct {
+	mode os.FileMode
+	size int64
+	hash [sha256.Size]byte
+	link string
+}
+
+// Preview runs result in a throwaway copy of dir and reports the files it
+// created, modified and deleted, along with its output. The real tree is
+// not touched: the command runs under bubblewrap, with the rest of the
+// file system mounted read-only, so symlinks and paths leading out of the
+// copy cannot change anything, and with the network and other processes
+// out of reach. Without bubblewrap nothing is previewed.
+func Preview(ctx context.Context, result Result, dir string) (*PreviewReport, error) {
+	if names := result.PlaceholderNames(); len(names) > 0 {
+		return nil, fmt.Errorf("fill in <%s> before previewing", strings.Join(names, ">, <"))
+	}
+	bwrap, err := exec.LookPath("bwrap")
+	if err != nil {
+		return nil, errors.New("previewing needs bubblewrap (bwrap) to keep the command away from the real files")
+	}
+
+	tmp, err := os.MkdirTemp("", "clai-preview-*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(tmp)
+	work := filepath.Join(tmp, previewWorkDirName)
+	copier := &treeCopier{maxFiles: maxPreviewFiles, maxBytes: maxPreviewBytes, owner: -1}
+	if err := copier.copy(dir, work); err != nil {
+		if errors.Is(err, errTreeTooLarge) {
+			return nil, fmt.Errorf("cannot preview, the working directory is %w", err)
+		}
+		return nil, err
+	}
+	before, err := snapshotTree(work)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, previewTimeout)
+	defer cancel()
+	shell := UserShell()
+	cmd := exec.CommandContext(ctx, bwrap,
+		"--ro-bind", "/", "/",
+		"--dev", "/dev",
+		"--proc", "/proc",
+		"--tmpfs", "/tmp",
+		// Sockets such as systemd's and docker's live in /run; unix
+		// sockets are reachable from another network namespace.
+		"--tmpfs", "/run",
+		"--bind", work, work,
+		"--chdir", work,
+		"--unshare-all",
+		"--die-with-parent",
+		shell, "-c", result.CommandLine())
+	stdout := &limitedBuffer{limit: maxPreviewOutput}
+	stderr := &limitedBuffer{limit: maxPreviewOutput}
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	report := &PreviewReport{Diffs: make(map[string]string)}
+	err = cmd.Run()
+	var exitErr *exec.ExitError
+	switch {
+	case errors.As(err, &exitErr):
+		report.ExitCode = exitErr.ExitCode()
+	case err != nil:
+		return nil, fmt.Errorf("failed to run preview: %w", err)
+	}
+	if ctx.Err() != nil {
+		return nil, fmt.Errorf("preview timed out after %s", previewTimeout)
+	}
+	report.Stdout = stdout.String()
+	report.Stderr = stderr.String()
+
+	after, err := snapshotTree(work)
+	if err != nil {
+		return nil, err
+	}
+	for path, state := range after {
+		previous, ok := before[path]
+		switch {
+		case !ok:
+			report.Created = append(report.Created, path)
+		case previous != state:
+			report.Modified = append(report.Modified, path)
+		}
+	}
+	for path := range before {
+		if _, ok := after[path]; !ok {
+			report.Deleted = append(report.Deleted, path)
+		}
+	}
+	sort.Strings(report.Created)
+	sort.Strings(report.Modified)
+	sort.Strings(report.Deleted)
+
+	for _, path := range report.Modified {
+		if len(report.Diffs) == maxPreviewDiffs {
+			break
+		}
+		if strings.HasSuffix(path, string(filepath.Separator)) {
+			continue
+		}
+		if diff := unifiedDiff(ctx, filepath.Join(dir, path), filepath.Join(work, path), path); diff != "" {
+			report.Diffs[path] = diff
+		}
+	}
+	return report, nil
+}
+
+var errTreeTooLarge = errors.New("too large to copy")
+
+// treeCopier copies files, directories and symlinks, counting them against
+// its limits across calls.
+type treeCopier struct {
+	maxFiles int
+	maxBytes int64
+	// preserve keeps exact modes and modification times and, when run as
+	// root, ownership, as undo needs them.
+	preserve bool
+	// owner, when not -1, makes copy fail with errNotOwned on an entry
+	// owned by anyone else.
+	owner int
+	files int
+	bytes int64
+}
+
+var errNotOwned = errors.New("owned by another user")
+
+// copy copies src, a file or a directory tree, to dst. Sockets, fifos and
+// devices are left out.
+func (c *treeCopier) copy(src, dst string) error {
+	type dirState struct {
+		path string
+		info fs.FileInfo
+	}
+	var dirs []dirState
+	err := filepath.WalkDir(src, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		if c.files++; c.files > c.maxFiles {
+			return fmt.Errorf("%w: more than %d files", errTreeTooLarge, c.maxFiles)
+		}
+		if c.owner != -1 {
+			if uid, ok := fileOwner(info); ok && uid != c.owner {
+				return fmt.Errorf("%s is %w", path, errNotOwned)
+			}
+		}
+		switch {
+		case entry.IsDir():
+			// Written into first, so the exact mode comes last.
+			dirs = append(dirs, dirState{target, info})
+			return os.MkdirAll(target, info.Mode().Perm()|0700)
+		case info.Mode()&fs.ModeSymlink != 0:
+			link, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			if err := os.Symlink(link, target); err != nil {
+				return err
+			}
+			return c.keepOwner(target, info)
+		case info.Mode().IsRegular():
+			if c.bytes += info.Size(); c.bytes > c.maxBytes {
+				return fmt.Errorf("%w: more than %d MB", errTreeTooLarge, c.maxBytes>>20)
+			}
+			if err := os.MkdirAll(filepath.Dir(target), 0700); err != nil {
+				return err
+			}
+			if err := copyFile(path, target, info.Mode().Perm()); err != nil {
+				return err
+			}
+			return c.keepAttributes(target, info)
+		default:
+			return nil
+		}
+	})
+	if err != nil || !c.preserve {
+		return err
+	}
+	// Deepest first, since setting a directory's mode can lock its
+	// parent's contents away.
+	for i := len(dirs) - 1; i >= 0; i-- {
+		if err := c.keepAttributes(dirs[i].path, dirs[i].info); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// keepAttributes gives path the mode, modification time and, when
+// possible, owner of info, if the copier preserves them.
+func (c *treeCopier) keepAttributes(path string, info fs.FileInfo) error {
+	if !c.preserve {
+		return nil
+	}
+	if err := c.keepOwner(path, info); err != nil {
+		return err
+	}
+	// Chmod drops the set-id bits when the owner changes, so it comes after.
+	if err := os.Chmod(path, info.Mode()&(fs.ModePerm|fs.ModeSetuid|fs.ModeSetgid|fs.ModeSticky)); err != nil {
+		return err
+	}
+	return os.Chtimes(path, info.ModTime(), info.ModTime())
+}
+
+// keepOwner gives path the owner of info when the copier preserves it
+// and runs as root; nobody else may.
+func (c *treeCopier) keepOwner(path string, info fs.FileInfo) error {
+	if !c.preserve || os.Geteuid() != 0 {
+		return nil
+	}
+	uid, gid, ok := fileOwnership(info)
+	if !ok {
+		return nil
+	}
+	return os.Lchown(path, uid, gid)
+}
+
+func copyFile(src, dst string, perm os.FileMode) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, perm)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// snapshotTree records the state of every entry under root, by path
+// relative to root. Directories end in a slash.
+func snapshotTree(root string) (map[string]fileState, error) {
+	states := make(map[string]fileState)
+	err := filepath.WalkDir(root, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if path == root {
+			return nil
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		state := fileState{mode: info.Mode()}
+		switch {
+		case entry.IsDir():
+			rel += string(filepath.Separator)
+		case info.Mode()&fs.ModeSymlink != 0:
+			state.link, _ = os.Readlink(path)
+		case info.Mode().IsRegular():
+			state.size = info.Size()
+			file, err := os.Open(path)
+			if err != nil {
+				return err
+			}
+			hash := sha256.New()
+			_, err = io.Copy(hash, file)
+			file.Close()
+			if err != nil {
+				return err
+			}
+			copy(state.hash[:], hash.Sum(nil))
+		}
+		states[rel] = state
+		return nil
+	})
+	return states, err
+}
+
+// unifiedDiff returns diff -u of two text files, or "" for binary files
+// or when diff is not installed.
+func unifiedDiff(ctx context.Context, before, after, label string) string {
+	if _, err := exec.LookPath("diff"); err != nil {
+		return ""
+	}
+	var output bytes.Buffer
+	cmd := exec.CommandContext(ctx, "diff", "-u", "--label", "a/"+label, "--label", "b/"+label, before, after)
+	cmd.Stdout = &output
+	// diff exits with 1 when the files differ.
+	cmd.Run()
+	text := output.String()
+	if strings.HasPrefix(text, "Binary files") {
+		return ""
+	}
+	if len(text) > maxPreviewDiff {
+		text = text[:maxPreviewDiff] + "\n... (diff truncated)\n"
+	}
+	return text
+}
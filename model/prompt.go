@@ -0,0 +1,326 @@
+package model
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+)
+
+const (
+	contextSize     = 2048
+	maxOutputTokens = 400
+	// promptSafetyTokens absorbs the error of estimateTokens against the
+	// real tokenizer.
+	promptSafetyTokens = 96
+	minSectionTokens   = 48
+	// separatorTokens is the cost of the blank line between blocks.
+	separatorTokens = 2
+)
+
+// ChatTemplate is the turn format an instruct model was trained on.
+type ChatTemplate string
+
+const (
+	TemplateGemma  ChatTemplate = "gemma"
+	TemplateLlama3 ChatTemplate = "llama3"
+	TemplateChatML ChatTemplate = "chatml"
+)
+
+// PromptConfig lets users of their own llamafile pick its chat template.
+type PromptConfig struct {
+	Template ChatTemplate `yaml:"template,omitempty"`
+}
+
+// templateFor returns the configured template, or the one matching the
+// model family, falling back to ChatML for models we do not know.
+func templateFor(modelType ModelType, cfg PromptConfig) ChatTemplate {
+	switch cfg.Template {
+	case TemplateGemma, TemplateLlama3, TemplateChatML:
+		return cfg.Template
+	}
+	name := strings.ToLower(modelType.String())
+	switch {
+	case strings.Contains(name, "gemma"):
+		return TemplateGemma
+	case strings.Contains(name, "llama-3"), strings.Contains(name, "llama3"):
+		return TemplateLlama3
+	default:
+		return TemplateChatML
+	}
+}
+
+// Wrap formats one system and one user turn and opens the assistant turn.
+// The BOS token is left out because llamafile adds it when tokenizing.
+func (t ChatTemplate) Wrap(system, user string) string {
+	switch t {
+	case TemplateGemma:
+		// Gemma has no system role; instructions go first in the user turn.
+		return "<start_of_turn>user\n" + system + "\n\n" + user + "<end_of_turn>\n<start_of_turn>model\n"
+	case TemplateLlama3:
+		return "<|start_header_id|>system<|end_header_id|>\n\n" + system + "<|eot_id|>" +
+			"<|start_header_id|>user<|end_header_id|>\n\n" + user + "<|eot_id|>" +
+			"<|start_header_id|>assistant<|end_header_id|>\n\n"
+	default:
+		return "<|im_start|>system\n" + system + "<|im_end|>\n" +
+			"<|im_start|>user\n" + user + "<|im_end|>\n" +
+			"<|im_start|>assistant\n"
+	}
+}
+
+// promptSection is an optional block of the user turn. When the prompt
+// does not fit, sections are cut or dropped starting with the lowest
+// priority.
+type promptSection struct {
+	text     string
+	priority int
+}
+
+const (
+	priorityExamples = iota + 1
+	priorityProviderContext
+	priorityManReference
+	priorityCatalog
+	priorityEnvironment
+)
+
+// PromptBuilder assembles the prompt for one query within the context
+// window left after reserving room for the answer.
+type PromptBuilder struct {
+	Template   ChatTemplate
+	Budget     int
+	MaxResults int
+	// Corrections are problems found in a previous answer to the same
+	// task, which the model should avoid repeating.
+	Corrections []string
+	// Plan asks for the ordered steps of the task, at most MaxResults,
+	// instead of alternative commands.
+	Plan bool
+}
+
+func NewPromptBuilder(template ChatTemplate) PromptBuilder {
+	return PromptBuilder{
+		Template:   template,
+		Budget:     contextSize - maxOutputTokens - promptSafetyTokens,
+		MaxResults: 4,
+	}
+}
+
+func (pb PromptBuilder) Build(userInput string, promptContext PromptContext, reference Reference, examples []Feedback) string {
+	system := buildInstructions(promptContext.Environment, pb.MaxResults)
+	if pb.Plan {
+		system = buildPlanInstructions(promptContext.Environment, pb.MaxResults)
+		// The examples are single commands, which would teach the wrong format.
+		examples = nil
+	}
+	task := fmt.Sprintf("Task: %s", userInput)
+	if strings.Contains(userInput, secretTokenPrefix) {
+		task += "\n" + secretTokenPrefix + "1 and the like stand for secret values; put them in the command exactly as written."
+	}
+
+	var sections []promptSection
+	if env := promptContext.Environment.String(); env != "" {
+		sections = append(sections, promptSection{"Environment:\n" + env, priorityEnvironment})
+	}
+	for _, section := range promptContext.Sections {
+		sections = append(sections, promptSection{section.Title + ":\n" + section.Body, priorityProviderContext})
+	}
+	if reference.Catalog != "" {
+		sections = append(sections, promptSection{
+			"In-house commands available here, use only the flags listed:\n[TEAM CATALOG]\n" + reference.Catalog + "\n[/TEAM CATALOG]",
+			priorityCatalog,
+		})
+	}
+	if reference.Man != "" {
+		sections = append(sections, promptSection{
+			"Reference material from relevant man pages:\n[MANPAGE EXCERPT]\n" + reference.Man + "\n[/MANPAGE EXCERPT]",
+			priorityManReference,
+		})
+	}
+	if text := formatExamples(examples); text != "" {
+		sections = append(sections, promptSection{text, priorityExamples})
+	}
+
+	// The instructions and the task are sent whole; the corrections get
+	// what room they leave, and the sections what is left after that.
+	remaining := pb.Budget - estimateTokens(pb.Template.Wrap(system, task))
+	if corrections := fitCorrections(pb.Corrections, remaining-separatorTokens); corrections != "" {
+		task = corrections + "\n\n" + task
+		remaining = pb.Budget - estimateTokens(pb.Template.Wrap(system, task))
+	}
+	kept := fitSections(sections, remaining)
+
+	blocks := append(kept, task)
+	return pb.Template.Wrap(system, strings.Join(blocks, "\n\n"))
+}
+
+// fitSections keeps the sections that fit in budget, in their original
+// order. Higher priority sections are placed first; a section that does
+// not fit whole is cut at a line boundary if a useful part of it fits.
+func fitSections(sections []promptSection, budget int) []string {
+	order := make([]int, len(sections))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		return sections[order[a]].priority > sections[order[b]].priority
+	})
+
+	texts := make([]string, len(sections))
+	for _, i := range order {
+		// Each block costs a blank line separator as well.
+		cost := estimateTokens(sections[i].text) + separatorTokens
+		if cost <= budget {
+			texts[i] = sections[i].text
+			budget -= cost
+			continue
+		}
+		if budget-separatorTokens < minSectionTokens {
+			continue
+		}
+		cut := truncateToTokens(sections[i].text, budget-separatorTokens)
+		if estimateTokens(cut) < minSectionTokens {
+			continue
+		}
+		texts[i] = closeTruncatedBlock(cut, sections[i].text)
+		budget -= estimateTokens(texts[i]) + separatorTokens
+	}
+
+	var kept []string
+	for _, text := range texts {
+		if text != "" {
+			kept = append(kept, text)
+		}
+	}
+	return kept
+}
+
+// fitCorrections lists corrections in at most budget tokens. The last
+// ones are the most recent, so earlier ones are dropped first, and one
+// that does not fit whole is cut at a line boundary.
+func fitCorrections(corrections []string, budget int) string {
+	const header = "Your previous answer had these problems, avoid them:"
+	budget -= estimateTokens(header)
+	var kept []string
+	for i := len(corrections) - 1; i >= 0; i-- {
+		item := "- " + corrections[i]
+		cost := estimateTokens(item) + 1
+		if cost > budget {
+			if budget-1 < minSectionTokens {
+				break
+			}
+			item = truncateToTokens(item, budget-1)
+			if estimateTokens(item) < minSectionTokens {
+				break
+			}
+			cost = estimateTokens(item) + 1
+		}
+		kept = append(kept, item)
+		budget -= cost
+	}
+	if len(kept) == 0 {
+		return ""
+	}
+	slices.Reverse(kept)
+	return header + "\n" + strings.Join(kept, "\n")
+}
+
+// closeTruncatedBlock re-adds the closing [/TAG] line of a bracketed block
+// that truncation cut off, so the model still sees where it ends.
+func closeTruncatedBlock(cut, full string) string {
+	lines := strings.Split(strings.TrimSpace(full), "\n")
+	last := lines[len(lines)-1]
+	if !strings.HasPrefix(last, "[/") || strings.HasSuffix(cut, last) {
+		return cut
+	}
+	return cut + "\n" + last
+}
+
+func buildInstructions(env Environment, maxResults int) string {
+	var builder strings.Builder
+	builder.WriteString("Generate shell commands as JSON array.\n\n")
+	builder.WriteString("Rules:\n")
+	if maxResults > 1 {
+		builder.WriteString(fmt.Sprintf("- Return 1-%d real %s commands only\n", maxResults, env.OSName()))
+	} else {
+		builder.WriteString(fmt.Sprintf("- Return exactly 1 real %s command\n", env.OSName()))
+	}
+	if env.PackageManager != "" {
+		builder.WriteString(fmt.Sprintf("- Use %s for package management\n", env.PackageManager))
+	}
+	builder.WriteString("- Most common solution first\n")
+	writeCommandRules(&builder)
+	builder.WriteString("JSON format:\n")
+	builder.WriteString(`[{"cmd":"command","args":["arg1","{{name}}"],"redirects":[{"op":">","target":"file"}],"pipeline":[{"op":"|","cmd":"command","args":["arg"]}],"risk":"read-only","requires_root":false,"placeholders":[{"name":"name","description":"what to enter"}],"explain":"description"}]`)
+	return builder.String()
+}
+
+// buildPlanInstructions asks for the steps of a task in order, each with
+// the steps it depends on and what it should achieve.
+func buildPlanInstructions(env Environment, maxSteps int) string {
+	var builder strings.Builder
+	builder.WriteString("Break the task into shell commands run one after another, as JSON array.\n\n")
+	builder.WriteString("Rules:\n")
+	builder.WriteString(fmt.Sprintf("- Return 1-%d steps in the order they must run, one real %s command each\n", maxSteps, env.OSName()))
+	if env.PackageManager != "" {
+		builder.WriteString(fmt.Sprintf("- Use %s for package management\n", env.PackageManager))
+	}
+	builder.WriteString("- title: what the step does, in a few words\n")
+	builder.WriteString("- depends_on: numbers of earlier steps that must succeed first, counting from 1\n")
+	builder.WriteString("- expect: what is true once the step succeeded\n")
+	writeCommandRules(&builder)
+	builder.WriteString("JSON format:\n")
+	builder.WriteString(`[{"title":"step","cmd":"command","args":["arg1","{{name}}"],"risk":"modifies-files","requires_root":false,"placeholders":[{"name":"name","description":"what to enter"}],"explain":"description","depends_on":[],"expect":"outcome"},{"title":"next step","cmd":"command","args":["arg"],"risk":"read-only","requires_root":false,"explain":"description","depends_on":[1],"expect":"outcome"}]`)
+	return builder.String()
+}
+
+// writeCommandRules adds the rules for writing one command, shared by
+// suggestions and plans.
+func writeCommandRules(builder *strings.Builder) {
+	builder.WriteString("- Use actual commands\n")
+	builder.WriteString("- Args as separate array elements\n")
+	builder.WriteString("- Chain commands with pipeline stages (op \"|\", \"&&\", \"||\" or \";\"), never inside args\n")
+	builder.WriteString("- Put redirections like > file or 2>&1 in redirects, never inside args\n")
+	builder.WriteString("- risk: read-only, modifies-files, destructive (deletes or overwrites data) or network\n")
+	builder.WriteString("- requires_root: true if the command needs sudo\n")
+	builder.WriteString("- Write values the user must supply as {{name}} and list them in placeholders\n\n")
+}
+
+// formatExamples shows accepted answers in the form the grammar makes
+// the model write, every required field present. Answers saved before
+// they had a risk cannot be shown that way and are left out.
+func formatExamples(examples []Feedback) string {
+	var builder strings.Builder
+	for _, example := range examples {
+		data, err := exampleJSON(example.Result)
+		if err != nil {
+			continue
+		}
+		builder.WriteString(fmt.Sprintf("Task: %s\nOutput: %s\n", example.Query, data))
+	}
+	if builder.Len() == 0 {
+		return ""
+	}
+	return "Examples of answers accepted in this environment:\n" + strings.TrimSpace(builder.String())
+}
+
+// exampleJSON marshals result as a one element answer, with empty
+// argument lists written as [] rather than null.
+func exampleJSON(result Result) ([]byte, error) {
+	switch result.Risk {
+	case RiskReadOnly, RiskModifiesFiles, RiskDestructive, RiskNetwork:
+	default:
+		return nil, fmt.Errorf("example %q has no risk", result.Cmd)
+	}
+	if result.Args == nil {
+		result.Args = []string{}
+	}
+	result.Pipeline = slices.Clone(result.Pipeline)
+	for i := range result.Pipeline {
+		if result.Pipeline[i].Args == nil {
+			result.Pipeline[i].Args = []string{}
+		}
+	}
+	return json.Marshal([]Result{result})
+}
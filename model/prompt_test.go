@@ -0,0 +1,87 @@
+package model
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestPromptBuilderFitsCorrections(t *testing.T) {
+	promptContext := PromptContext{
+		Environment: Environment{OS: "linux", Shell: "bash", Cwd: "/srv/app"},
+		Sections:    []ContextSection{{Title: "Git", Body: strings.Repeat("modified: src/file.go\n", 40)}},
+	}
+	reference := Reference{Man: strings.Repeat("-r, --recursive  remove directories and their contents\n", 60)}
+	output := strings.Repeat("error: cannot open file: permission denied\n", 200)
+
+	tests := []struct {
+		name        string
+		corrections []string
+		want        []string
+	}{
+		{"none", nil, []string{"[MANPAGE EXCERPT]"}},
+		{"short", []string{"tar failed with exit code 2"}, []string{"- tar failed with exit code 2", "[MANPAGE EXCERPT]"}},
+		{"too large", []string{
+			"cp failed with exit code 1",
+			"rsync failed with exit code 23 and printed:\n" + output,
+		}, []string{"- rsync failed with exit code 23 and printed:\nerror: cannot open file"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			builder := NewPromptBuilder(TemplateChatML)
+			builder.Corrections = test.corrections
+			prompt := builder.Build("copy the backups to the server", promptContext, reference, nil)
+			if tokens := estimateTokens(prompt); tokens > builder.Budget {
+				t.Errorf("prompt takes %d tokens, budget is %d", tokens, builder.Budget)
+			}
+			for _, want := range append(test.want, "Generate shell commands", "Task: copy the backups to the server") {
+				if !strings.Contains(prompt, want) {
+					t.Errorf("prompt lacks %q", want)
+				}
+			}
+		})
+	}
+}
+
+func TestFitCorrections(t *testing.T) {
+	var corrections []string
+	for i := 1; i <= 20; i++ {
+		corrections = append(corrections, fmt.Sprintf("attempt %d failed with exit code 1 and printed:\n%s", i, strings.Repeat("no such file or directory\n", 10)))
+	}
+	text := fitCorrections(corrections, 200)
+	if tokens := estimateTokens(text); tokens > 200 {
+		t.Errorf("corrections take %d tokens, want at most 200", tokens)
+	}
+	if !strings.Contains(text, "- attempt 20 failed") || strings.Contains(text, "- attempt 1 failed") {
+		t.Errorf("want the latest corrections kept and the earliest dropped, got:\n%s", text)
+	}
+	if text := fitCorrections(corrections, 10); text != "" {
+		t.Errorf("no room: got %q, want nothing", text)
+	}
+}
+
+func TestFormatExamplesHasRequiredFields(t *testing.T) {
+	examples := []Feedback{
+		{Query: "list files", Result: Result{Cmd: "ls", Risk: RiskReadOnly, Explain: "lists files"}},
+		{Query: "count lines", Result: Result{
+			Cmd: "cat", Args: []string{"log.txt"}, Risk: RiskReadOnly,
+			Pipeline: []Stage{{Op: "|", Cmd: "wc", Args: []string{"-l"}}, {Op: "|", Cmd: "sort"}},
+		}},
+		{Query: "from an older version", Result: Result{Cmd: "df", Args: []string{"-h"}}},
+	}
+	text := formatExamples(examples)
+	want := `Examples of answers accepted in this environment:
+Task: list files
+Output: [{"cmd":"ls","args":[],"risk":"read-only","requires_root":false,"explain":"lists files"}]
+Task: count lines
+Output: [{"cmd":"cat","args":["log.txt"],"pipeline":[{"op":"|","cmd":"wc","args":["-l"]},{"op":"|","cmd":"sort","args":[]}],"risk":"read-only","requires_root":false,"explain":""}]`
+	if text != want {
+		t.Errorf("formatExamples =\n%s\nwant\n%s", text, want)
+	}
+	if examples[1].Result.Pipeline[1].Args != nil {
+		t.Error("formatExamples changed the example it was given")
+	}
+	if text := formatExamples(examples[2:]); text != "" {
+		t.Errorf("examples without a risk: got %q, want nothing", text)
+	}
+}
@@ -0,0 +1,325 @@
+package model
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// Dialect is the shell a command line is rendered for.
+type Dialect string
+
+const (
+	DialectPOSIX Dialect = "sh"
+	DialectBash  Dialect = "bash"
+	DialectZsh   Dialect = "zsh"
+	DialectFish  Dialect = "fish"
+)
+
+// DialectForShell picks the dialect from a shell path such as /bin/zsh.
+func DialectForShell(shell string) Dialect {
+	switch filepath.Base(shell) {
+	case "bash":
+		return DialectBash
+	case "zsh":
+		return DialectZsh
+	case "fish":
+		return DialectFish
+	default:
+		return DialectPOSIX
+	}
+}
+
+// TokenKind tells renderers what a piece of a command line is.
+type TokenKind int
+
+const (
+	TokenCommand TokenKind = iota
+	TokenArg
+	TokenOperator
+	TokenRedirect
+)
+
+// Token is one word of a rendered command line, already quoted.
+type Token struct {
+	Kind TokenKind
+	Text string
+}
+
+// patternCommands take patterns or programs as arguments, so their
+// wildcards are meant for the command and not for the shell.
+var patternCommands = map[string]struct{}{
+	"grep": {}, "egrep": {}, "fgrep": {}, "rg": {}, "ag": {}, "sed": {},
+	"awk": {}, "gawk": {}, "perl": {}, "jq": {}, "yq": {}, "pgrep": {},
+	"pkill": {}, "locate": {}, "expr": {}, "printf": {}, "echo": {},
+}
+
+// programCommands take a program text (awk '{print $NF}', sed 's/$/;/')
+// whose $ is meant for them and never for the shell.
+var programCommands = map[string]struct{}{
+	"awk": {}, "gawk": {}, "mawk": {}, "sed": {}, "perl": {}, "jq": {}, "yq": {},
+}
+
+// patternFlags are options whose value is a pattern for the command.
+var patternFlags = map[string]struct{}{
+	"-name": {}, "-iname": {}, "-path": {}, "-ipath": {}, "-wholename": {},
+	"-iwholename": {}, "-regex": {}, "-iregex": {}, "-lname": {}, "-ilname": {},
+	"--include": {}, "--exclude": {}, "--exclude-dir": {}, "--include-dir": {},
+	"-e": {}, "--regexp": {}, "-g": {}, "--glob": {}, "-x": {}, "-X": {},
+	"--wildcards": {}, "-not": {}, "-I": {}, "--ignore": {}, "-P": {}, "-pattern": {},
+}
+
+// Tokens renders every stage of the result for dialect d, quoting each
+// argument so that the shell passes it through unchanged, except for
+// wildcards meant for the shell, variables, command substitutions, a
+// leading ~ and {{name}} placeholders, which stay active.
+func (r Result) Tokens(d Dialect) []Token {
+	var tokens []Token
+	for _, stage := range r.Stages() {
+		if stage.Op != "" {
+			tokens = append(tokens, Token{TokenOperator, stage.Op})
+		}
+		tokens = append(tokens, Token{TokenCommand, quoteWord(d, stage.Cmd, false, true)})
+		_, program := programCommands[filepath.Base(stage.Cmd)]
+		previous := ""
+		for _, arg := range stage.Args {
+			glob := shellGlobIntended(stage.Cmd, previous, arg)
+			tokens = append(tokens, Token{TokenArg, quoteWord(d, arg, glob, !program)})
+			previous = arg
+		}
+		for _, redirect := range stage.Redirects {
+			tokens = append(tokens, redirectTokens(d, redirect)...)
+		}
+	}
+	return tokens
+}
+
+// Render returns the command line for dialect d.
+func (r Result) Render(d Dialect) string {
+	var words []string
+	for _, token := range r.Tokens(d) {
+		words = append(words, token.Text)
+	}
+	return strings.Join(words, " ")
+}
+
+func redirectTokens(d Dialect, redirect Redirect) []Token {
+	target := quoteWord(d, redirect.Target, false, true)
+	switch {
+	case redirect.Op == "&>" && d == DialectPOSIX:
+		// &> is a bash extension; sh would run the command in the
+		// background and truncate the file.
+		return []Token{{TokenRedirect, ">" + target}, {TokenRedirect, "2>&1"}}
+	case redirect.Target == "":
+		return []Token{{TokenRedirect, redirect.Op}}
+	default:
+		return []Token{{TokenRedirect, redirect.Op + target}}
+	}
+}
+
+// shellGlobIntended guesses whether wildcards in arg are for the shell to
+// expand: not for pattern taking commands, after pattern flags, or in
+// something that is clearly not a file name.
+func shellGlobIntended(command, previous, arg string) bool {
+	if !strings.ContainsAny(arg, "*?[") {
+		return false
+	}
+	if _, ok := patternCommands[filepath.Base(command)]; ok {
+		return false
+	}
+	if _, ok := patternFlags[previous]; ok {
+		return false
+	}
+	if filepath.Base(command) == "find" {
+		// find's arguments after the start paths are expressions.
+		return false
+	}
+	return !strings.HasPrefix(arg, "-") && !strings.ContainsAny(arg, " \t\n'\"\\|&;<>(){}=")
+}
+
+type wordPart struct {
+	text   string
+	active bool // expanded by the shell rather than taken literally
+	quoted bool // active, but safe inside double quotes
+}
+
+// quoteWord quotes word for dialect d. Literal runs are single quoted when
+// they contain anything special, variables and command substitutions are
+// double quoted so that their values are not split unless expand is off,
+// and wildcards are left bare when glob is set.
+func quoteWord(d Dialect, word string, glob, expand bool) string {
+	if word == "" {
+		return "''"
+	}
+	var builder strings.Builder
+	for _, part := range splitWord(d, word, glob, expand) {
+		switch {
+		case part.quoted:
+			builder.WriteString(`"` + part.text + `"`)
+		case part.active:
+			builder.WriteString(part.text)
+		default:
+			builder.WriteString(quoteLiteral(d, part.text))
+		}
+	}
+	return builder.String()
+}
+
+func splitWord(d Dialect, word string, glob, expand bool) []wordPart {
+	var parts []wordPart
+	var literal strings.Builder
+	flush := func() {
+		if literal.Len() > 0 {
+			parts = append(parts, wordPart{text: literal.String()})
+			literal.Reset()
+		}
+	}
+
+	if expand && strings.HasPrefix(word, "~") {
+		end := strings.IndexByte(word, '/')
+		if end < 0 {
+			end = len(word)
+		}
+		if isUserName(word[1:end]) {
+			parts = append(parts, wordPart{text: word[:end], active: true})
+			word = word[end:]
+		}
+	}
+
+	for i := 0; i < len(word); {
+		if strings.HasPrefix(word[i:], "{{") {
+			if match := placeholderPattern.FindStringIndex(word[i:]); match != nil && match[0] == 0 {
+				flush()
+				parts = append(parts, wordPart{text: word[i : i+match[1]], active: true})
+				i += match[1]
+				continue
+			}
+		}
+		if word[i] == '$' && expand {
+			if n := expansionLength(word[i:]); n > 0 {
+				flush()
+				text := word[i : i+n]
+				if d == DialectFish && strings.HasPrefix(text, "${") {
+					text = "$" + text[2:len(text)-1]
+				}
+				parts = append(parts, wordPart{text: text, active: true, quoted: true})
+				i += n
+				continue
+			}
+		}
+		if glob && isGlobChar(d, word[i]) {
+			n := 1
+			if word[i] == '[' {
+				n = strings.IndexByte(word[i:], ']') + 1
+			}
+			if n > 1 || word[i] != '[' {
+				flush()
+				parts = append(parts, wordPart{text: word[i : i+n], active: true})
+				i += n
+				continue
+			}
+		}
+		literal.WriteByte(word[i])
+		i++
+	}
+	flush()
+	return parts
+}
+
+func isGlobChar(d Dialect, c byte) bool {
+	if d == DialectFish {
+		// fish has no [...] classes and ? globbing is deprecated.
+		return c == '*'
+	}
+	return c == '*' || c == '?' || c == '['
+}
+
+// expansionLength returns the length of the variable or command
+// substitution at the start of s, or 0 if there is none.
+func expansionLength(s string) int {
+	if len(s) < 2 {
+		return 0
+	}
+	switch {
+	case s[1] == '{':
+		if end := strings.IndexByte(s, '}'); end > 2 && isIdentifier(s[2:end]) {
+			return end + 1
+		}
+	case s[1] == '(':
+		depth := 0
+		for i := 1; i < len(s); i++ {
+			switch s[i] {
+			case '(':
+				depth++
+			case ')':
+				depth--
+				if depth == 0 {
+					return i + 1
+				}
+			}
+		}
+	case isIdentifierStart(s[1]):
+		n := 2
+		for n < len(s) && isIdentifierChar(s[n]) {
+			n++
+		}
+		return n
+	}
+	return 0
+}
+
+func isIdentifier(s string) bool {
+	if s == "" || !isIdentifierStart(s[0]) {
+		return false
+	}
+	for i := 1; i < len(s); i++ {
+		if !isIdentifierChar(s[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func isIdentifierStart(c byte) bool {
+	return c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+func isIdentifierChar(c byte) bool {
+	return isIdentifierStart(c) || c >= '0' && c <= '9'
+}
+
+func isUserName(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if !isIdentifierChar(s[i]) && s[i] != '-' && s[i] != '.' {
+			return false
+		}
+	}
+	return true
+}
+
+// quoteLiteral makes text a literal word part for dialect d.
+func quoteLiteral(d Dialect, text string) string {
+	if isSafeLiteral(d, text) {
+		return text
+	}
+	if d == DialectFish {
+		// Inside fish single quotes only \' and \\ are escapes.
+		return "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(text) + "'"
+	}
+	return "'" + strings.ReplaceAll(text, "'", `'\''`) + "'"
+}
+
+func isSafeLiteral(d Dialect, text string) bool {
+	for i := 0; i < len(text); i++ {
+		c := text[i]
+		switch {
+		case isIdentifierChar(c):
+		case strings.IndexByte("@%+:,./-", c) >= 0:
+		case c == '=' && i > 0:
+			// zsh expands a leading = to a command path.
+		default:
+			return false
+		}
+	}
+	// fish used to treat a leading % as process expansion.
+	return !(d == DialectFish && strings.HasPrefix(text, "%"))
+}
@@ -0,0 +1,186 @@
+package model
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// dialectShells are the shells each dialect is checked against, with the
+// options that keep them from reading any configuration.
+var dialectShells = map[Dialect][][]string{
+	DialectPOSIX: {{"sh"}, {"dash"}, {"bash", "--posix"}},
+	DialectBash:  {{"bash", "--norc", "--noprofile"}},
+	DialectZsh:   {{"zsh", "-f"}},
+	DialectFish:  {{"fish", "--no-config"}},
+}
+
+// placeholderValues fill the {{name}} placeholders of the round trip
+// tests, quoted into the line the way Fill does.
+var placeholderValues = map[string]string{
+	"file": "my file's copy",
+	"msg":  `50% "off" $HOME *`,
+}
+
+// argsScript stands in for every command of a line: it appends its
+// arguments, each ended by a NUL, and a newline to $ARGS_LOG, and writes
+// a line to stdout and to stderr for redirects to catch.
+const argsScript = `#!/bin/sh
+for arg; do printf '%s\0' "$arg" >>"$ARGS_LOG"; done
+printf '\n' >>"$ARGS_LOG"
+echo out
+echo err >&2
+`
+
+// TestRenderRoundTrip renders results for each dialect, has the real shell
+// run the line with every command replaced by argsScript and compares the
+// arguments each stage is given with the ones meant. Redirect targets
+// must be created under the name given. Shells that are not installed
+// are skipped.
+func TestRenderRoundTrip(t *testing.T) {
+	const home = "/home/clai"
+	script := filepath.Join(t.TempDir(), "args")
+	if err := os.WriteFile(script, []byte(argsScript), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		result Result
+		want   []string // the first command's, nil when they come through unchanged
+	}{
+		{"spaces", Result{Cmd: "cat", Args: []string{"my notes.txt", " lead", "trail "}}, nil},
+		{"shell glob", Result{Cmd: "rm", Args: []string{"*.log"}}, []string{"a.log", "b.log"}},
+		{"glob with space", Result{Cmd: "rm", Args: []string{"my *.log"}}, nil},
+		{"glob for find", Result{Cmd: "find", Args: []string{".", "-name", "*.log", "-o", "-path", "./[ab]?"}}, nil},
+		{"glob for grep", Result{Cmd: "grep", Args: []string{"-r", "a*b", "."}}, nil},
+		{"variable", Result{Cmd: "cp", Args: []string{"$HOME/.bashrc", "${HOME}/backup"}}, []string{home + "/.bashrc", home + "/backup"}},
+		{"home", Result{Cmd: "ls", Args: []string{"~/notes", "~"}}, []string{home + "/notes", home}},
+		{"dollar for awk", Result{Cmd: "awk", Args: []string{"{print $1, $NF}", "data.txt"}}, nil},
+		{"dollar for sed", Result{Cmd: "sed", Args: []string{"s/$/;/", "data.txt"}}, nil},
+		{"lone dollar", Result{Cmd: "echo", Args: []string{"$", "5$", "$1.00"}}, nil},
+		{"quotes", Result{Cmd: "echo", Args: []string{"it's", `say "hi"`, `'both"`}}, nil},
+		{"find exec", Result{Cmd: "find", Args: []string{".", "-name", "*.tmp", "-exec", "rm", "{}", ";"}}, nil},
+		{"find exec plus", Result{Cmd: "find", Args: []string{".", "-exec", "ls", "{}", "+"}}, nil},
+		{"braces", Result{Cmd: "echo", Args: []string{"{a,b}", "{}", "x{1..3}"}}, nil},
+		{"backslashes", Result{Cmd: "echo", Args: []string{`a\b`, `\;`, `\`, `C:\\dir`}}, nil},
+		{"operators", Result{Cmd: "echo", Args: []string{"a|b", "a&b", "a;b", "<in>", "(x)", "#hash", "a#b"}}, nil},
+		{"leading characters", Result{Cmd: "echo", Args: []string{"=ls", "%1", "!x", "^y", "-"}}, nil},
+		{"empty", Result{Cmd: "printf", Args: []string{"", "x"}}, nil},
+		{"pipeline", Result{Cmd: "grep", Args: []string{"-i", "error|warn", "app log.txt"}, Pipeline: []Stage{
+			{Op: "|", Cmd: "sort", Args: []string{"-t", "|", "-k", "2"}},
+			{Op: "|", Cmd: "awk", Args: []string{"{print $2}"}},
+		}}, nil},
+		{"chained", Result{Cmd: "mkdir", Args: []string{"-p", "out dir"}, Pipeline: []Stage{
+			{Op: "&&", Cmd: "cp", Args: []string{"my notes.txt", "out dir"}},
+			{Op: ";", Cmd: "echo", Args: []string{"done; or not", "&&"}},
+		}}, nil},
+		{"stderr into pipe", Result{Cmd: "make", Args: []string{"all"}, Redirects: []Redirect{{Op: "2>&1"}}, Pipeline: []Stage{
+			{Op: "|", Cmd: "tee", Args: []string{"build log.txt"}},
+		}}, nil},
+		{"redirect to file with space", Result{Cmd: "echo", Args: []string{"a > b"}, Redirects: []Redirect{
+			{Op: ">", Target: "file with space"},
+			{Op: "2>>", Target: "it's $1.err"},
+		}}, nil},
+		{"redirect and stderr", Result{Cmd: "ls", Args: []string{"-l"}, Redirects: []Redirect{
+			{Op: ">", Target: "list (all).txt"},
+			{Op: "2>&1"},
+		}}, nil},
+		{"input redirect", Result{Cmd: "wc", Args: []string{"-l"}, Redirects: []Redirect{{Op: "<", Target: "my notes.txt"}}}, nil},
+		{"placeholder in quoted text", Result{Cmd: "git", Args: []string{"commit", "-m", "it's {{msg}} today", "--", "{{file}}"}}, nil},
+		{"placeholder next to glob", Result{Cmd: "cp", Args: []string{"{{file}}*.txt", "{{file}}/"}}, nil},
+		{"placeholder in redirect", Result{Cmd: "echo", Args: []string{"{{msg}}"}, Redirects: []Redirect{{Op: ">>", Target: "{{file}}.txt"}}}, nil},
+	}
+
+	for dialect, shells := range dialectShells {
+		for _, shell := range shells {
+			path, err := exec.LookPath(shell[0])
+			if err != nil {
+				continue
+			}
+			for _, test := range tests {
+				t.Run(string(dialect)+"/"+strings.Join(shell, " ")+"/"+test.name, func(t *testing.T) {
+					dir := t.TempDir()
+					for _, name := range []string{"a.log", "b.log", "my notes.txt"} {
+						if err := os.WriteFile(filepath.Join(dir, name), nil, 0o644); err != nil {
+							t.Fatal(err)
+						}
+					}
+					log := filepath.Join(t.TempDir(), "args.log")
+					fill := func(text string, quote bool) string {
+						return ReplacePlaceholders(text, func(name string) string {
+							if quote {
+								return quoteWord(dialect, placeholderValues[name], false, false)
+							}
+							return placeholderValues[name]
+						})
+					}
+
+					var words []string
+					for _, token := range test.result.Tokens(dialect) {
+						if token.Kind == TokenCommand {
+							token.Text = quoteWord(dialect, script, false, false)
+						}
+						words = append(words, fill(token.Text, true))
+					}
+					line := strings.Join(words, " ")
+
+					cmd := exec.Command(path, append(shell[1:], "-c", line)...)
+					cmd.Dir = dir
+					cmd.Env = []string{"HOME=" + home, "PATH=" + os.Getenv("PATH"), "ARGS_LOG=" + log}
+					out, err := cmd.CombinedOutput()
+					if err != nil {
+						t.Fatalf("%s -c %s: %v\n%s", shell[0], line, err, out)
+					}
+					data, err := os.ReadFile(log)
+					if err != nil {
+						t.Fatal(err)
+					}
+					var got [][]string
+					for _, invocation := range strings.Split(strings.TrimSuffix(string(data), "\n"), "\n") {
+						args := strings.Split(invocation, "\x00")
+						got = append(got, args[:len(args)-1])
+					}
+
+					var want [][]string
+					for i, stage := range test.result.Stages() {
+						args := test.want
+						if i > 0 || args == nil {
+							args = make([]string, len(stage.Args))
+							for j, arg := range stage.Args {
+								args[j] = fill(arg, false)
+							}
+						}
+						want = append(want, args)
+						for _, redirect := range stage.Redirects {
+							if redirect.Target == "" || redirect.Op == "<" {
+								continue
+							}
+							target := fill(redirect.Target, false)
+							if _, err := os.Stat(filepath.Join(dir, target)); err != nil {
+								t.Errorf("%s -c %s did not write %q", shell[0], line, target)
+							}
+						}
+					}
+					// The commands of a pipeline run at the same time and
+					// log in any order.
+					if !slices.Equal(sortedInvocations(got), sortedInvocations(want)) {
+						t.Errorf("%s -c %s\ngot  %q\nwant %q", shell[0], line, got, want)
+					}
+				})
+			}
+		}
+	}
+}
+
+func sortedInvocations(invocations [][]string) []string {
+	var sorted []string
+	for _, args := range invocations {
+		sorted = append(sorted, strings.Join(args, "\x00"))
+	}
+	slices.Sort(sorted)
+	return sorted
+}
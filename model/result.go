@@ -0,0 +1,131 @@
+package model
+
+import "regexp"
+
+// Risk classifies what running a suggestion does to the system.
+type Risk string
+
+const (
+	RiskReadOnly      Risk = "read-only"
+	RiskModifiesFiles Risk = "modifies-files"
+	RiskDestructive   Risk = "destructive"
+	RiskNetwork       Risk = "network"
+)
+
+// Result is one suggested command line. Cmd and Args are the first
+// command; Pipeline holds the commands chained after it.
+type Result struct {
+	Cmd          string        `json:"cmd"`
+	Args         []string      `json:"args"`
+	Redirects    []Redirect    `json:"redirects,omitempty"`
+	Pipeline     []Stage       `json:"pipeline,omitempty"`
+	Risk         Risk          `json:"risk"`
+	RequiresRoot bool          `json:"requires_root"`
+	Placeholders []Placeholder `json:"placeholders,omitempty"`
+	Explain      string        `json:"explain"`
+
+	// Warnings are the problems validation found and Decision is the
+	// safety policy's verdict; neither is part of what the model returns.
+	Warnings []string       `json:"-"`
+	Decision PolicyDecision `json:"-"`
+	// Line is the command line as the user typed it, when they edited
+	// one. It is what runs, the fields being only what it was parsed to.
+	Line string `json:"-"`
+}
+
+// Stage is a command joined to the previous one by Op: "|", "&&", "||"
+// or ";".
+type Stage struct {
+	Op        string     `json:"op"`
+	Cmd       string     `json:"cmd"`
+	Args      []string   `json:"args"`
+	Redirects []Redirect `json:"redirects,omitempty"`
+}
+
+// Redirect is an I/O redirection such as "> out.txt" or "2>&1", which
+// has no target.
+type Redirect struct {
+	Op     string `json:"op"`
+	Target string `json:"target,omitempty"`
+}
+
+// Placeholder is a value the user has to supply, written as {{name}} in
+// the arguments.
+type Placeholder struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	Default     string `json:"default,omitempty"`
+}
+
+var placeholderPattern = regexp.MustCompile(`\{\{\s*([A-Za-z0-9_-]+)\s*\}\}`)
+
+// ReplacePlaceholders calls replace for every {{name}} in text and
+// substitutes its result.
+func ReplacePlaceholders(text string, replace func(name string) string) string {
+	return placeholderPattern.ReplaceAllStringFunc(text, func(match string) string {
+		return replace(placeholderPattern.FindStringSubmatch(match)[1])
+	})
+}
+
+// Stages returns every command of the line, the first with an empty Op.
+func (r Result) Stages() []Stage {
+	stages := []Stage{{Cmd: r.Cmd, Args: r.Args, Redirects: r.Redirects}}
+	return append(stages, r.Pipeline...)
+}
+
+// PlaceholderNames returns the placeholders used in the arguments and
+// redirect targets, in order of first use.
+func (r Result) PlaceholderNames() []string {
+	var names []string
+	seen := make(map[string]struct{})
+	collect := func(text string) {
+		for _, match := range placeholderPattern.FindAllStringSubmatch(text, -1) {
+			if _, ok := seen[match[1]]; !ok {
+				seen[match[1]] = struct{}{}
+				names = append(names, match[1])
+			}
+		}
+	}
+	for _, stage := range r.Stages() {
+		for _, arg := range stage.Args {
+			collect(arg)
+		}
+		for _, redirect := range stage.Redirects {
+			collect(redirect.Target)
+		}
+	}
+	return names
+}
+
+// CommandLine renders the result, correctly quoted, for the user's shell.
+// A line the user typed is returned as is.
+func (r Result) CommandLine() string {
+	if r.Line != "" {
+		return r.Line
+	}
+	return r.Render(DialectForShell(UserShell()))
+}
+
+// resultGrammar is the GBNF grammar for a JSON array of results. Fields
+// come in a fixed order; redirects, pipeline and placeholders are optional.
+const resultGrammar = `root ::= ws "[" ws (object (ws "," ws object)*)? ws "]" ws
+object ::= "{" ws fields ws "}"
+` + commandGrammarRules
+
+// commandGrammarRules describe the fields of one command, shared by the
+// result and plan grammars.
+const commandGrammarRules = `fields ::= "\"cmd\"" ws ":" ws string ws "," ws "\"args\"" ws ":" ws array (ws "," ws "\"redirects\"" ws ":" ws redirects)? (ws "," ws "\"pipeline\"" ws ":" ws pipeline)? ws "," ws "\"risk\"" ws ":" ws risk ws "," ws "\"requires_root\"" ws ":" ws boolean (ws "," ws "\"placeholders\"" ws ":" ws placeholders)? ws "," ws "\"explain\"" ws ":" ws string
+pipeline ::= "[" ws (stage (ws "," ws stage)*)? ws "]"
+stage ::= "{" ws "\"op\"" ws ":" ws stageop ws "," ws "\"cmd\"" ws ":" ws string ws "," ws "\"args\"" ws ":" ws array (ws "," ws "\"redirects\"" ws ":" ws redirects)? ws "}"
+stageop ::= "\"|\"" | "\"&&\"" | "\"||\"" | "\";\""
+redirects ::= "[" ws (redirect (ws "," ws redirect)*)? ws "]"
+redirect ::= "{" ws "\"op\"" ws ":" ws redirectop (ws "," ws "\"target\"" ws ":" ws string)? ws "}"
+redirectop ::= "\">\"" | "\">>\"" | "\"<\"" | "\"2>\"" | "\"2>>\"" | "\"2>&1\"" | "\"&>\""
+risk ::= "\"read-only\"" | "\"modifies-files\"" | "\"destructive\"" | "\"network\""
+boolean ::= "true" | "false"
+placeholders ::= "[" ws (placeholder (ws "," ws placeholder)*)? ws "]"
+placeholder ::= "{" ws "\"name\"" ws ":" ws string (ws "," ws "\"description\"" ws ":" ws string)? (ws "," ws "\"default\"" ws ":" ws string)? ws "}"
+array ::= "[" ws (string (ws "," ws string)*)? ws "]"
+string ::= "\"" char* "\""
+char ::= [^"\\\x7F\x00-\x1F] | "\\" (["\\/bfnrt] | "u" [0-9a-fA-F] [0-9a-fA-F] [0-9a-fA-F] [0-9a-fA-F])
+ws ::= [ \t\n\r]*`
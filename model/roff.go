@@ -0,0 +1,625 @@
+package model
+
+import (
+	"strings"
+)
+
+const (
+	roffTextIndent = 7
+	roffTagIndent  = 7
+	roffBodyIndent = 14
+	roffLineWidth  = 80
+)
+
+// roffGlyphs maps the \(xx and \[xx] special characters that show up in
+// command man pages to plain ASCII.
+var roffGlyphs = map[string]string{
+	"em": "--", "en": "-", "hy": "-", "mi": "-", "ti": "~", "ha": "^",
+	"aq": "'", "dq": "\"", "lq": "\"", "rq": "\"", "oq": "'", "cq": "'",
+	"bu": "*", "co": "(c)", "rg": "(R)", "tm": "(TM)", "rs": "\\", "sl": "/",
+	"ga": "`", "at": "@", "sh": "#", "Fo": "<<", "Fc": ">>", "fo": "<", "fc": ">",
+	"->": "->", "<-": "<-", "<=": "<=", ">=": ">=", "!=": "!=", "==": "==",
+	"mu": "x", "pl": "+", "eq": "=", "dg": "+", "lB": "[", "rB": "]",
+	"lC": "{", "rC": "}", "la": "<", "ra": ">", "ba": "|", "or": "|",
+	"sq": "'", "Bq": "\"", "bq": "'", "R": "(R)", "Tm": "(TM)",
+}
+
+// renderRoff turns man(7) or mdoc(7) source into indented plain text, close
+// enough to `man | col -b` for sliceManSections. Section headers are written
+// unindented and everything else indented, as man does.
+func renderRoff(source string) string {
+	r := roffRenderer{}
+	lines := joinContinuationLines(strings.Split(source, "\n"))
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		if r.skipUntil != "" {
+			if strings.HasPrefix(strings.TrimSpace(line), r.skipUntil) {
+				r.skipUntil = ""
+			}
+			continue
+		}
+		if r.tableFormat {
+			if strings.HasSuffix(strings.TrimSpace(line), ".") {
+				r.tableFormat = false
+			}
+			continue
+		}
+		macro, args := splitRoffRequest(line)
+		if macro == "" && !isRoffControl(line) {
+			r.text(roffEscapes(line))
+			continue
+		}
+		r.request(macro, args)
+	}
+	r.flush()
+	return strings.TrimRight(r.out.String(), "\n") + "\n"
+}
+
+type roffRenderer struct {
+	out         strings.Builder
+	line        []string
+	lineIndent  int
+	indent      int
+	extraIndent int
+	pendingTag  bool
+	noFill      bool
+	skipUntil   string
+	tableFormat bool
+	inTable     bool
+	docName     string
+	inSynopsis  bool
+	spacingOff  bool
+	listDepth   int
+}
+
+func (r *roffRenderer) request(macro string, args []string) {
+	switch macro {
+	case "", `\"`, "TH", "Dd", "Dt", "Os", "ft", "ne", "hy", "nh", "ad", "na",
+		"ll", "lt", "nr", "ds", "so", "IX", "PD", "UC", "hw", "ta", "ns", "rs",
+		"Bk", "Ek", "Bd", "Ed", "Rs", "Re", "An", "cs", "ss", "mso",
+		"EX", "EE", "nf", "fi", "ie", "el", "if", "tr", "ig", "ce", "ps", "vs",
+		"UE", "ME", "YS", "fam", "pc", "cc", "c2", "ev", "Lb", "Ux", "At", "Bx":
+		switch macro {
+		case "nf", "EX", "Bd":
+			r.flush()
+			r.noFill = macro != "Bd" || containsArg(args, "-literal", "-unfilled")
+		case "fi", "EE", "Ed":
+			r.flush()
+			r.noFill = false
+		case "ig":
+			r.skipUntil = ".."
+		case "if", "ie", "el":
+			// Conditional requests are mostly formatter tweaks; keep any
+			// plain text that follows a troff-only or nroff-only condition.
+			if len(args) >= 2 && (args[0] == "n" || args[0] == "!t") && !strings.HasPrefix(args[1], ".") && !strings.HasPrefix(args[1], `\{`) {
+				r.text(roffEscapes(strings.Join(args[1:], " ")))
+			}
+		}
+		return
+	case "de", "de1", "am":
+		r.skipUntil = ".."
+	case "TS":
+		r.tableFormat = true
+		r.inTable = true
+	case "TE":
+		r.inTable = false
+	case "SH", "Sh":
+		r.heading(strings.ToUpper(roffJoin(args, " ")), 0)
+		r.inSynopsis = strings.EqualFold(roffJoin(args, " "), "SYNOPSIS")
+	case "SS", "Ss":
+		r.heading(roffJoin(args, " "), 3)
+	case "PP", "P", "LP", "Pp", "sp", "Lp":
+		if r.listDepth == 0 {
+			r.indent = r.extraIndent
+		}
+		r.pendingTag = false
+		r.paragraph()
+	case "br":
+		r.flush()
+	case "RS":
+		r.extraIndent += roffBodyIndent - roffTextIndent
+		r.indent = r.extraIndent
+	case "RE":
+		r.extraIndent -= roffBodyIndent - roffTextIndent
+		if r.extraIndent < 0 {
+			r.extraIndent = 0
+		}
+		r.indent = r.extraIndent
+	case "in":
+		// Indentation changes are approximated by the RS/RE levels.
+	case "TP", "TQ":
+		r.paragraph()
+		r.pendingTag = true
+	case "IP", "It":
+		r.paragraph()
+		tag := ""
+		if macro == "It" {
+			tag = r.mdoc(args)
+		} else if len(args) > 0 {
+			tag = roffEscapes(args[0])
+		}
+		if tag != "" {
+			r.writeLine(roffTagIndent+r.extraIndent, tag)
+		}
+		r.indent = r.extraIndent + roffBodyIndent - roffTextIndent
+	case "HP":
+		r.paragraph()
+	case "B", "I", "SM", "SB":
+		r.text(roffJoin(args, " "))
+	case "BR", "BI", "IB", "IR", "RB", "RI":
+		r.text(roffJoin(args, ""))
+	case "SY":
+		r.paragraph()
+		r.text(roffJoin(args, " "))
+	case "OP":
+		r.text("[" + roffJoin(args, " ") + "]")
+	case "UR", "MT":
+		r.text(roffJoin(args, " "))
+	case "Nm":
+		if r.docName == "" && len(args) > 0 {
+			r.docName = roffEscapes(args[0])
+		}
+		if r.inSynopsis {
+			r.flush()
+		}
+		r.text(r.mdoc(append([]string{"Nm"}, args...)))
+	case "Nd":
+		r.text("- " + r.mdoc(args))
+	case "D1", "Dl":
+		r.writeLine(roffBodyIndent+r.extraIndent, r.mdoc(args))
+	case "Sm":
+		r.spacingOff = len(args) > 0 && args[0] == "off"
+	case "Bl":
+		r.paragraph()
+		r.listDepth++
+	case "El":
+		r.paragraph()
+		if r.listDepth > 0 {
+			r.listDepth--
+		}
+		r.indent = r.extraIndent
+	default:
+		if isMdocMacro(macro) {
+			r.text(r.mdoc(append([]string{macro}, args...)))
+		}
+	}
+}
+
+func (r *roffRenderer) mdoc(tokens []string) string {
+	return renderMdoc(tokens, r.docName, r.spacingOff)
+}
+
+func (r *roffRenderer) heading(title string, indent int) {
+	r.paragraph()
+	r.writeLine(indent, title)
+	r.indent = 0
+	r.extraIndent = 0
+	r.pendingTag = false
+	r.noFill = false
+	r.listDepth = 0
+}
+
+func (r *roffRenderer) text(text string) {
+	if r.inTable {
+		text = strings.ReplaceAll(text, "\t", "  ")
+	}
+	if strings.TrimSpace(text) == "" {
+		if text == "" && !r.noFill {
+			r.paragraph()
+		}
+		return
+	}
+	if r.pendingTag {
+		r.writeLine(roffTagIndent+r.extraIndent, text)
+		r.pendingTag = false
+		r.indent = r.extraIndent + roffBodyIndent - roffTextIndent
+		return
+	}
+	if r.noFill || r.inTable {
+		r.writeLine(roffTextIndent+r.indent, text)
+		return
+	}
+	if len(r.line) == 0 {
+		r.lineIndent = roffTextIndent + r.indent
+	}
+	words := strings.Fields(text)
+	if r.spacingOff && len(r.line) > 0 {
+		r.line[len(r.line)-1] += words[0]
+		words = words[1:]
+	}
+	r.line = append(r.line, words...)
+}
+
+// flush writes the filled words collected so far, wrapped at roffLineWidth.
+func (r *roffRenderer) flush() {
+	if len(r.line) == 0 {
+		return
+	}
+	words := r.line
+	r.line = nil
+	var current strings.Builder
+	for _, word := range words {
+		if current.Len() > 0 && r.lineIndent+current.Len()+1+len(word) > roffLineWidth {
+			r.writeLine(r.lineIndent, current.String())
+			current.Reset()
+		}
+		if current.Len() > 0 {
+			current.WriteByte(' ')
+		}
+		current.WriteString(word)
+	}
+	if current.Len() > 0 {
+		r.writeLine(r.lineIndent, current.String())
+	}
+}
+
+func (r *roffRenderer) writeLine(indent int, text string) {
+	if len(r.line) > 0 {
+		r.flush()
+	}
+	r.out.WriteString(strings.Repeat(" ", indent))
+	r.out.WriteString(strings.TrimSpace(text))
+	r.out.WriteString("\n")
+}
+
+func (r *roffRenderer) paragraph() {
+	r.flush()
+	out := r.out.String()
+	if out == "" || strings.HasSuffix(out, "\n\n") {
+		return
+	}
+	r.out.WriteString("\n")
+}
+
+func containsArg(args []string, wanted ...string) bool {
+	for _, arg := range args {
+		for _, w := range wanted {
+			if arg == w {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func isRoffControl(line string) bool {
+	return strings.HasPrefix(line, ".") || strings.HasPrefix(line, "'")
+}
+
+// joinContinuationLines merges lines ending in an escaped newline and lines
+// whose text ends in \c with the line that follows.
+func joinContinuationLines(lines []string) []string {
+	var joined []string
+	var current strings.Builder
+	for _, line := range lines {
+		trimmed := strings.TrimRight(line, " ")
+		if strings.HasSuffix(trimmed, `\c`) || (strings.HasSuffix(trimmed, `\`) && !strings.HasSuffix(trimmed, `\\`)) {
+			current.WriteString(strings.TrimSuffix(strings.TrimSuffix(trimmed, `\c`), `\`))
+			continue
+		}
+		current.WriteString(line)
+		joined = append(joined, current.String())
+		current.Reset()
+	}
+	if current.Len() > 0 {
+		joined = append(joined, current.String())
+	}
+	return joined
+}
+
+// splitRoffRequest splits a control line into its macro and arguments,
+// honouring double-quoted arguments. Text lines return an empty macro.
+func splitRoffRequest(line string) (string, []string) {
+	if !isRoffControl(line) {
+		return "", nil
+	}
+	body := strings.TrimLeft(line[1:], " \t")
+	if strings.HasPrefix(body, `\"`) {
+		return `\"`, nil
+	}
+	if idx := strings.Index(body, `\"`); idx >= 0 {
+		body = body[:idx]
+	}
+	// The name ends at a blank or a quote: .SH"NAME" is .SH "NAME".
+	end := strings.IndexAny(body, " \t\"")
+	if end < 0 {
+		end = len(body)
+	}
+	if end == 0 {
+		return "", nil
+	}
+	return body[:end], splitRoffArgs(body[end:])
+}
+
+func splitRoffArgs(body string) []string {
+	var args []string
+	var current strings.Builder
+	inQuotes, hasArg := false, false
+	for i := 0; i < len(body); i++ {
+		c := body[i]
+		switch {
+		case c == '\\' && i+1 < len(body):
+			current.WriteByte(c)
+			current.WriteByte(body[i+1])
+			i++
+			hasArg = true
+		case c == '"' && inQuotes && i+1 < len(body) && body[i+1] == '"':
+			current.WriteByte('"')
+			i++
+		case c == '"':
+			inQuotes = !inQuotes
+			hasArg = true
+		case (c == ' ' || c == '\t') && !inQuotes:
+			if hasArg {
+				args = append(args, current.String())
+				current.Reset()
+				hasArg = false
+			}
+		default:
+			current.WriteByte(c)
+			hasArg = true
+		}
+	}
+	if hasArg {
+		args = append(args, current.String())
+	}
+	return args
+}
+
+func roffJoin(args []string, sep string) string {
+	rendered := make([]string, 0, len(args))
+	for _, arg := range args {
+		rendered = append(rendered, roffEscapes(arg))
+	}
+	return strings.Join(rendered, sep)
+}
+
+// roffEscapes resolves the escapes that affect the visible text and drops
+// font, size and motion escapes.
+func roffEscapes(text string) string {
+	if !strings.Contains(text, `\`) {
+		return text
+	}
+	var out strings.Builder
+	for i := 0; i < len(text); i++ {
+		c := text[i]
+		if c != '\\' || i+1 >= len(text) {
+			out.WriteByte(c)
+			continue
+		}
+		i++
+		switch e := text[i]; e {
+		case '"':
+			return out.String()
+		case '\\', 'e', 'E':
+			out.WriteByte('\\')
+		case '-', '_':
+			out.WriteByte(e)
+		case ' ', '~', '0':
+			out.WriteByte(' ')
+		case '&', '|', '^', '%', ')', 'c', ':', '/', ',':
+		case '.':
+			out.WriteByte('.')
+		case '\'':
+			out.WriteByte('\'')
+		case '`':
+			out.WriteByte('`')
+		case 't':
+			out.WriteByte('\t')
+		case '(':
+			if i+2 < len(text) {
+				out.WriteString(roffGlyph(text[i+1 : i+3]))
+				i += 2
+			}
+		case '[':
+			end := strings.IndexByte(text[i:], ']')
+			if end < 0 {
+				return out.String()
+			}
+			out.WriteString(roffGlyph(text[i+1 : i+end]))
+			i += end
+		case '*':
+			name, skip := roffEscapeName(text[i+1:])
+			out.WriteString(roffGlyph(name))
+			i += skip
+		case 'f', 'F', 'n', 'm', 'M', 'g', 'k', 'V', 'Y':
+			_, skip := roffEscapeName(text[i+1:])
+			i += skip
+		case 's':
+			j := i + 1
+			if j < len(text) && (text[j] == '+' || text[j] == '-') {
+				j++
+			}
+			if j < len(text) && (text[j] == '(' || text[j] == '[') {
+				_, skip := roffEscapeName(text[j:])
+				j += skip
+			} else {
+				for j < len(text) && text[j] >= '0' && text[j] <= '9' {
+					j++
+				}
+			}
+			i = j - 1
+		case 'h', 'v', 'w', 'o', 'l', 'L', 'D', 'X', 'x', 'b', 'A', 'B', 'C', 'N', 'R', 'Z':
+			// Delimited escapes: \h'...', \w'...' and friends.
+			if i+1 < len(text) {
+				delim := text[i+1]
+				end := strings.IndexByte(text[i+2:], delim)
+				if end >= 0 {
+					if e == 'C' || e == 'N' {
+						out.WriteString(roffGlyph(text[i+2 : i+2+end]))
+					}
+					i += end + 2
+				}
+			}
+		default:
+			out.WriteByte(e)
+		}
+	}
+	return out.String()
+}
+
+// roffEscapeName reads the name following \f, \*, \n and similar, which is
+// one character, two after "(", or anything up to "]" after "[".
+func roffEscapeName(rest string) (string, int) {
+	if rest == "" {
+		return "", 0
+	}
+	switch rest[0] {
+	case '(':
+		if len(rest) < 3 {
+			return "", len(rest)
+		}
+		return rest[1:3], 3
+	case '[':
+		end := strings.IndexByte(rest, ']')
+		if end < 0 {
+			return "", len(rest)
+		}
+		return rest[1:end], end + 1
+	default:
+		return rest[:1], 1
+	}
+}
+
+func roffGlyph(name string) string {
+	if glyph, ok := roffGlyphs[name]; ok {
+		return glyph
+	}
+	if strings.HasPrefix(name, "u") && len(name) == 5 {
+		return ""
+	}
+	if len(name) == 1 {
+		return name
+	}
+	return ""
+}
+
+var mdocMacros = map[string]struct{}{
+	"Fl": {}, "Ar": {}, "Op": {}, "Oo": {}, "Oc": {}, "Ns": {}, "Cm": {},
+	"Pa": {}, "Xr": {}, "Ql": {}, "Dq": {}, "Sq": {}, "Pq": {}, "Li": {},
+	"Ic": {}, "Em": {}, "Sy": {}, "Ev": {}, "Va": {}, "Dv": {}, "No": {},
+	"Nm": {}, "Er": {}, "Fn": {}, "Fa": {}, "Ft": {}, "Ad": {}, "Lk": {},
+	"Mt": {}, "Aq": {}, "Bq": {}, "Brq": {}, "Qq": {}, "Do": {}, "Dc": {},
+	"Po": {}, "Pc": {}, "Qo": {}, "Qc": {}, "So": {}, "Sc": {}, "Tn": {},
+	"Cd": {}, "St": {}, "Ex": {}, "Rv": {}, "Ms": {}, "Ta": {}, "Xo": {},
+	"Xc": {}, "Ap": {}, "Pf": {}, "Dx": {}, "Fx": {}, "Nx": {}, "Ox": {},
+	"Bsx": {}, "Lb": {}, "In": {}, "Fd": {}, "Vt": {}, "Ot": {}, "Eo": {},
+	"Ec": {},
+}
+
+func isMdocMacro(name string) bool {
+	_, ok := mdocMacros[name]
+	return ok
+}
+
+// mdocEnclosures wrap the rest of the line.
+var mdocEnclosures = map[string][2]string{
+	"Op": {"[", "]"}, "Dq": {"\"", "\""}, "Sq": {"'", "'"}, "Ql": {"'", "'"},
+	"Pq": {"(", ")"}, "Aq": {"<", ">"}, "Bq": {"[", "]"}, "Brq": {"{", "}"},
+	"Qq": {"\"", "\""},
+}
+
+// mdocOpeners emit a fixed string and continue with the following tokens.
+var mdocOpeners = map[string]string{
+	"Oo": "[", "Oc": "]", "Do": "\"", "Dc": "\"", "Po": "(", "Pc": ")",
+	"Qo": "\"", "Qc": "\"", "So": "'", "Sc": "'",
+}
+
+// renderMdoc renders one line of mdoc macros and words. With spacingOff, as
+// after ".Sm off", words are joined without spaces.
+func renderMdoc(tokens []string, docName string, spacingOff bool) string {
+	var out strings.Builder
+	noSpace := true
+	emit := func(text string) {
+		if text == "" {
+			return
+		}
+		if !noSpace && !spacingOff && !isClosingPunctuation(text) {
+			out.WriteByte(' ')
+		}
+		out.WriteString(text)
+		noSpace = false
+	}
+
+	for i := 0; i < len(tokens); i++ {
+		token := tokens[i]
+		if enclosure, ok := mdocEnclosures[token]; ok {
+			inner := renderMdoc(tokens[i+1:], docName, spacingOff)
+			emit(enclosure[0] + inner + enclosure[1])
+			break
+		}
+		if opener, ok := mdocOpeners[token]; ok {
+			if strings.HasSuffix(token, "o") {
+				emit(opener)
+				noSpace = true
+			} else {
+				out.WriteString(opener)
+				noSpace = false
+			}
+			continue
+		}
+		switch token {
+		case "Ns", "Ap":
+			noSpace = true
+			if token == "Ap" {
+				out.WriteByte('\'')
+			}
+			continue
+		case "Fl":
+			// Fl prefixes a dash to each following plain word.
+			if i+1 >= len(tokens) || isMdocMacro(tokens[i+1]) || isClosingPunctuation(tokens[i+1]) {
+				emit("-")
+				continue
+			}
+			for i+1 < len(tokens) && !isMdocMacro(tokens[i+1]) && !isClosingPunctuation(tokens[i+1]) {
+				i++
+				emit("-" + roffEscapes(tokens[i]))
+			}
+			continue
+		case "Nm":
+			if i+1 < len(tokens) && !isMdocMacro(tokens[i+1]) && !isClosingPunctuation(tokens[i+1]) {
+				continue
+			}
+			emit(docName)
+			continue
+		case "Xr":
+			if i+2 < len(tokens) {
+				emit(roffEscapes(tokens[i+1]) + "(" + tokens[i+2] + ")")
+				i += 2
+			}
+			continue
+		case "Pf":
+			if i+1 < len(tokens) {
+				emit(roffEscapes(tokens[i+1]))
+				noSpace = true
+				i++
+			}
+			continue
+		case "Ex":
+			emit("The " + docName + " utility exits 0 on success, and >0 if an error occurs.")
+			return out.String()
+		case "Ta":
+			emit("\t")
+			noSpace = true
+			continue
+		case "Ar":
+			if i+1 >= len(tokens) || isMdocMacro(tokens[i+1]) || isClosingPunctuation(tokens[i+1]) {
+				emit("file ...")
+			}
+			continue
+		}
+		if isMdocMacro(token) {
+			continue
+		}
+		emit(roffEscapes(token))
+	}
+	return out.String()
+}
+
+func isClosingPunctuation(token string) bool {
+	switch token {
+	case ".", ",", ";", ":", ")", "]", "?", "!", "|":
+		return true
+	}
+	return false
+}
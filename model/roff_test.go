@@ -0,0 +1,107 @@
+package model
+
+import "testing"
+
+func TestRenderRoff(t *testing.T) {
+	tests := []struct {
+		name   string
+		source string
+		want   string
+	}{
+		{"man headings", `.TH LS 1 "March 2024" "GNU coreutils"
+.SH NAME
+ls \- list directory contents
+.SH"SYNOPSIS"
+.B ls
+[\fIOPTION\fR]... [\fIFILE\fR]...
+.  SH DESCRIPTION
+List information about the FILEs.
+.SS "Sorting"
+By name.
+`, `NAME
+       ls - list directory contents
+
+SYNOPSIS
+       ls [OPTION]... [FILE]...
+
+DESCRIPTION
+       List information about the FILEs.
+
+   Sorting
+       By name.
+`},
+		{"tagged paragraphs", `.SH OPTIONS
+.TP
+\fB\-a\fR, \fB\-\-all\fR
+do not ignore entries starting with .
+.IP "\fB\-\-format\fR=\fIWORD\fR" 4
+across, commas or long
+`, `OPTIONS
+
+       -a, --all
+              do not ignore entries starting with .
+
+       --format=WORD
+              across, commas or long
+`},
+		{"font and glyph escapes", `.SH EXAMPLES
+Use \f(CWtar \-czf\fP or \f[B]tar\f[] \(em it\(aqs \*(lqfast\*(rq.
+`, `EXAMPLES
+       Use tar -czf or tar -- it's "fast".
+`},
+		{"mdoc", `.Dd May 1, 2020
+.Dt CP 1
+.Os
+.Sh NAME
+.Nm cp
+.Nd copy files
+.Sh SYNOPSIS
+.Nm
+.Op Fl R
+.Ar source_file target_file
+.Sh DESCRIPTION
+.Bl -tag -width flag
+.It Fl f
+Force.
+.It Fl n Ar num
+Count.
+.El
+`, `NAME
+       cp - copy files
+
+SYNOPSIS
+       cp [-R] source_file target_file
+
+DESCRIPTION
+
+       -f
+              Force.
+
+       -n num
+              Count.
+`},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := renderRoff(test.source); got != test.want {
+				t.Errorf("renderRoff =\n%s\nwant\n%s", got, test.want)
+			}
+		})
+	}
+}
+
+func TestNameSectionDescription(t *testing.T) {
+	tests := map[string]string{
+		".TH TAR 1\n.SH NAME\ntar \\- an archiving utility\n.SH SYNOPSIS\n": "an archiving utility",
+		".TH TAR 1\n.SH \"NAME\"\ntar \\- an archiving utility\n":           "an archiving utility",
+		".TH TAR 1\n.SH\"NAME\"\ntar \\- an archiving utility\n":            "an archiving utility",
+		".TH TAR 1\n.  SH NAME\ntar \\- an archiving utility\n":             "an archiving utility",
+		".TH TAR 1\n.SH NAMES\ntar \\- an archiving utility\n":              "",
+		".Sh NAME\n.Nm cp\n.Nd copy files\n.Sh SYNOPSIS\n.Nm\n":             "copy files",
+	}
+	for source, want := range tests {
+		if got := nameSectionDescription(source); got != want {
+			t.Errorf("nameSectionDescription(%q) = %q, want %q", source, got, want)
+		}
+	}
+}
@@ -0,0 +1,153 @@
+package model
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+const scriptCheckTimeout = 10 * time.Second
+
+// WriteScript checks a generated script with bash -n, then writes it to
+// path and marks it executable.
+func WriteScript(path, script string) error {
+	if err := CheckScript(script); err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, []byte(script), 0644); err != nil {
+		return err
+	}
+	return os.Chmod(path, 0755)
+}
+
+// CheckScript parses script with bash -n, without running it.
+func CheckScript(script string) error {
+	bash, err := exec.LookPath("bash")
+	if err != nil {
+		return fmt.Errorf("bash is needed to check the script: %w", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), scriptCheckTimeout)
+	defer cancel()
+	var output bytes.Buffer
+	cmd := exec.CommandContext(ctx, bash, "-n")
+	cmd.Stdin = strings.NewReader(script)
+	cmd.Stdout = &output
+	cmd.Stderr = &output
+	if err := cmd.Run(); err != nil {
+		if text := strings.TrimSpace(output.String()); text != "" {
+			return fmt.Errorf("the script has a syntax error: %s", firstLine(text))
+		}
+		return fmt.Errorf("failed to check the script: %w", err)
+	}
+	return nil
+}
+
+// writeScriptOptions adds a usage function and the parsing of one
+// --option per placeholder. Options without a default are required.
+func writeScriptOptions(builder *strings.Builder, task string, placeholders []Placeholder) {
+	type option struct {
+		flag, variable, help string
+		required             bool
+		value                string
+	}
+	options := make([]option, len(placeholders))
+	width := len("-h, --help")
+	for i, placeholder := range placeholders {
+		variable := scriptVariable(placeholder.Name)
+		opt := option{
+			flag:     "--" + strings.ReplaceAll(strings.TrimPrefix(variable, "_"), "_", "-"),
+			variable: variable,
+			help:     strings.Join(strings.Fields(placeholder.Description), " "),
+			required: placeholder.Default == "",
+			value:    placeholder.Default,
+		}
+		if opt.required {
+			opt.help = strings.TrimSpace(opt.help + " (required)")
+		} else {
+			opt.help = strings.TrimSpace(fmt.Sprintf("%s (default: %s)", opt.help, opt.value))
+		}
+		width = max(width, len(opt.flag+" VALUE"))
+		options[i] = opt
+	}
+
+	builder.WriteString("\nusage() {\n")
+	builder.WriteString("\techo \"Usage: ${0##*/}")
+	if len(options) > 0 {
+		builder.WriteString(" [options]")
+	}
+	builder.WriteString("\"\n")
+	builder.WriteString("\tcat <<'USAGE'\n")
+	for _, line := range strings.Split(strings.TrimSpace(task), "\n") {
+		builder.WriteString(line + "\n")
+	}
+	builder.WriteString("\nOptions:\n")
+	for _, opt := range options {
+		fmt.Fprintf(builder, "  %-*s  %s\n", width, opt.flag+" VALUE", opt.help)
+	}
+	fmt.Fprintf(builder, "  %-*s  %s\n", width, "-h, --help", "show this help")
+	builder.WriteString("USAGE\n}\n\n")
+
+	for _, opt := range options {
+		fmt.Fprintf(builder, "%s=%s\n", opt.variable, quoteLiteral(DialectBash, opt.value))
+	}
+	builder.WriteString("while [ $# -gt 0 ]; do\n\tcase \"$1\" in\n")
+	for _, opt := range options {
+		fmt.Fprintf(builder, "\t%s)\n", opt.flag)
+		builder.WriteString("\t\t[ $# -ge 2 ] || { echo \"$1 needs a value\" >&2; exit 2; }\n")
+		fmt.Fprintf(builder, "\t\t%s=$2\n\t\tshift 2\n\t\t;;\n", opt.variable)
+		fmt.Fprintf(builder, "\t%s=*)\n\t\t%s=${1#*=}\n\t\tshift\n\t\t;;\n", opt.flag, opt.variable)
+	}
+	builder.WriteString("\t-h | --help)\n\t\tusage\n\t\texit 0\n\t\t;;\n")
+	builder.WriteString("\t*)\n\t\techo \"Unknown option: $1\" >&2\n\t\tusage >&2\n\t\texit 2\n\t\t;;\n")
+	builder.WriteString("\tesac\ndone\n")
+	for _, opt := range options {
+		if !opt.required {
+			continue
+		}
+		fmt.Fprintf(builder, "if [ -z \"$%s\" ]; then\n", opt.variable)
+		fmt.Fprintf(builder, "\techo %s >&2\n", quoteLiteral(DialectBash, "Missing "+opt.flag))
+		builder.WriteString("\tusage >&2\n\texit 2\nfi\n")
+	}
+}
+
+// scriptLine renders result for bash with its placeholders replaced by
+// the script's variables. Placeholders are never inside quotes in the
+// rendered line, so the variables expand wherever they are.
+func scriptLine(result Result) string {
+	line := result.Line
+	if line == "" {
+		line = result.Render(DialectBash)
+	}
+	return ReplacePlaceholders(line, func(name string) string {
+		return `"${` + scriptVariable(name) + `}"`
+	})
+}
+
+// scriptVariable turns a placeholder name into a shell variable name.
+// It is lower case, so that a placeholder called PATH does not replace
+// the environment variable.
+func scriptVariable(name string) string {
+	variable := []byte(strings.ToLower(name))
+	for i, c := range variable {
+		if !isIdentifierChar(c) {
+			variable[i] = '_'
+		}
+	}
+	if len(variable) == 0 || !isIdentifierStart(variable[0]) {
+		variable = append([]byte{'_'}, variable...)
+	}
+	return string(variable)
+}
+
+// scriptComment turns text into comment lines.
+func scriptComment(text string) string {
+	var builder strings.Builder
+	for _, line := range strings.Split(strings.TrimSpace(text), "\n") {
+		builder.WriteString(strings.TrimRight("# "+line, " ") + "\n")
+	}
+	return builder.String()
+}
@@ -0,0 +1,50 @@
+package model
+
+import "unicode"
+
+// charsPerWordToken is how many letters of a word the Gemma and Llama
+// tokenizers cover with one token on average; common words are a single
+// token, long or rare ones split into pieces.
+const charsPerWordToken = 6
+
+// estimateTokens approximates how many tokens text costs in the prompt
+// without loading the model's tokenizer. Words cost one token per started
+// charsPerWordToken letters, while punctuation and other symbols, which
+// shell syntax and JSON are full of, mostly cost a token each. A single
+// space folds into the following token. The estimate errs on the high side.
+func estimateTokens(text string) int {
+	tokens := 0
+	wordLength := 0
+	spaces := 0
+	flushWord := func() {
+		if wordLength > 0 {
+			tokens += (wordLength + charsPerWordToken - 1) / charsPerWordToken
+			wordLength = 0
+		}
+	}
+	for _, r := range text {
+		if r != ' ' && r != '\t' {
+			// A run of indentation is one token of its own.
+			if spaces > 1 {
+				tokens++
+			}
+			spaces = 0
+		}
+		switch {
+		case r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r)):
+			wordLength++
+		case r == ' ' || r == '\t':
+			flushWord()
+			spaces++
+		case r == '\n':
+			flushWord()
+			tokens++
+		default:
+			// Symbols and non-ASCII characters.
+			flushWord()
+			tokens++
+		}
+	}
+	flushWord()
+	return tokens
+}
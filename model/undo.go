@@ -0,0 +1,389 @@
+package model
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	UNDO_BASE_FOLDER       = "undo"
+	SNAPSHOT_MANIFEST_NAME = "snapshot.json"
+	defaultUndoMaxSizeMB   = 100
+	defaultUndoMaxAgeDays  = 7
+	maxUndoSnapshots       = 10
+	maxSnapshotFiles       = 10000
+)
+
+// errNoSnapshot is returned by LatestSnapshot when there is nothing to undo.
+var errNoSnapshot = errors.New("nothing to undo")
+
+// UndoConfig controls the backups taken before clai runs a command that
+// changes files.
+type UndoConfig struct {
+	Disabled   bool `yaml:"disabled,omitempty"`
+	MaxSizeMB  int  `yaml:"max_size_mb,omitempty"`
+	MaxAgeDays int  `yaml:"max_age_days,omitempty"`
+}
+
+func (c UndoConfig) maxBytes() int64 {
+	if c.MaxSizeMB > 0 {
+		return int64(c.MaxSizeMB) << 20
+	}
+	return defaultUndoMaxSizeMB << 20
+}
+
+func (c UndoConfig) maxAge() time.Duration {
+	days := c.MaxAgeDays
+	if days <= 0 {
+		days = defaultUndoMaxAgeDays
+	}
+	return time.Duration(days) * 24 * time.Hour
+}
+
+// mutatingCommands change the files they are given. The value tells
+// whether the last argument is a destination that may not exist yet.
+var mutatingCommands = map[string]bool{
+	"rm": false, "rmdir": false, "unlink": false, "shred": false,
+	"chmod": false, "chown": false, "chgrp": false, "truncate": false,
+	"patch": false, "dd": false, "rename": false,
+	"mv": true, "cp": true, "ln": true, "install": true, "rsync": true,
+}
+
+// newFileCommands create the files they are given.
+var newFileCommands = map[string]struct{}{
+	"touch": {}, "tee": {}, "mkdir": {},
+}
+
+// Snapshot is a backup of the paths a command was about to change.
+type Snapshot struct {
+	Time    time.Time       `json:"time"`
+	Cwd     string          `json:"cwd"`
+	Command string          `json:"command"`
+	Entries []SnapshotEntry `json:"entries"`
+	// Skipped are the paths left out because undo, which runs as the
+	// user, could not put them back: those owned by someone else, as
+	// after sudo, or in a directory the user cannot write to.
+	Skipped []string `json:"skipped,omitempty"`
+
+	dir string
+}
+
+// SnapshotEntry is one backed up path. A path that did not exist is
+// recorded too, so that undo removes what the command created.
+type SnapshotEntry struct {
+	Path    string `json:"path"`
+	Existed bool   `json:"existed"`
+	Backup  string `json:"backup,omitempty"`
+}
+
+// UndoDir is where snapshots are kept.
+func UndoDir() (string, error) {
+	cacheDir, err := CacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(cacheDir, UNDO_BASE_FOLDER), nil
+}
+
+// TakeSnapshot backs up the paths result would change, if it changes any,
+// with their modes and modification times. It returns nil when there is
+// nothing to back up, and an error when the paths are larger than the
+// configured limit. Paths that could not be restored are skipped; when
+// that is all of them, the snapshot has no entries and is not kept.
+func TakeSnapshot(cfg UndoConfig, result Result, secrets *Redactor) (*Snapshot, error) {
+	cwd, err := os.Getwd()
+	if err != nil {
+		return nil, err
+	}
+	paths := affectedPaths(result, cwd)
+	if len(paths) == 0 {
+		return nil, nil
+	}
+	undoDir, err := UndoDir()
+	if err != nil {
+		return nil, err
+	}
+	pruneSnapshots(undoDir, cfg)
+
+	snapshot := &Snapshot{
+		Time:    time.Now(),
+		Cwd:     cwd,
+		Command: secrets.RedactResult(result).CommandLine(),
+		dir:     filepath.Join(undoDir, time.Now().Format("20060102-150405.000000000")),
+	}
+	if err := os.MkdirAll(snapshot.dir, 0700); err != nil {
+		return nil, err
+	}
+	root := os.Geteuid() == 0
+	copier := &treeCopier{maxFiles: maxSnapshotFiles, maxBytes: cfg.maxBytes(), preserve: true, owner: os.Geteuid()}
+	if root {
+		copier.owner = -1
+	}
+	for i, path := range paths {
+		entry := SnapshotEntry{Path: path}
+		if !root && !canWrite(filepath.Dir(path)) {
+			snapshot.Skipped = append(snapshot.Skipped, path)
+			continue
+		}
+		if _, err := os.Lstat(path); err == nil {
+			entry.Existed = true
+			entry.Backup = strconv.Itoa(i)
+			backup := filepath.Join(snapshot.dir, entry.Backup)
+			if err := copier.copy(path, backup); errors.Is(err, errNotOwned) {
+				os.RemoveAll(backup)
+				snapshot.Skipped = append(snapshot.Skipped, path)
+				continue
+			} else if err != nil {
+				os.RemoveAll(snapshot.dir)
+				return nil, fmt.Errorf("%s is %w", path, err)
+			}
+		}
+		snapshot.Entries = append(snapshot.Entries, entry)
+	}
+	if len(snapshot.Entries) == 0 {
+		os.RemoveAll(snapshot.dir)
+		return snapshot, nil
+	}
+	data, err := json.MarshalIndent(snapshot, "", "  ")
+	if err != nil {
+		os.RemoveAll(snapshot.dir)
+		return nil, err
+	}
+	if err := os.WriteFile(filepath.Join(snapshot.dir, SNAPSHOT_MANIFEST_NAME), data, 0600); err != nil {
+		os.RemoveAll(snapshot.dir)
+		return nil, err
+	}
+	return snapshot, nil
+}
+
+// ListSnapshots returns the snapshots that have not expired, newest first.
+func ListSnapshots(cfg UndoConfig) ([]*Snapshot, error) {
+	undoDir, err := UndoDir()
+	if err != nil {
+		return nil, err
+	}
+	pruneSnapshots(undoDir, cfg)
+	return readSnapshots(undoDir)
+}
+
+func readSnapshots(undoDir string) ([]*Snapshot, error) {
+	entries, err := os.ReadDir(undoDir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var snapshots []*Snapshot
+	for _, entry := range entries {
+		dir := filepath.Join(undoDir, entry.Name())
+		data, err := os.ReadFile(filepath.Join(dir, SNAPSHOT_MANIFEST_NAME))
+		if err != nil {
+			continue
+		}
+		var snapshot Snapshot
+		if err := json.Unmarshal(data, &snapshot); err != nil {
+			continue
+		}
+		snapshot.dir = dir
+		snapshots = append(snapshots, &snapshot)
+	}
+	sort.Slice(snapshots, func(i, j int) bool { return snapshots[i].Time.After(snapshots[j].Time) })
+	return snapshots, nil
+}
+
+// pruneSnapshots removes expired snapshots, those over the count limit
+// and leftovers of snapshots that were never completed.
+func pruneSnapshots(undoDir string, cfg UndoConfig) {
+	snapshots, err := readSnapshots(undoDir)
+	if err != nil {
+		return
+	}
+	keep := make(map[string]struct{})
+	for i, snapshot := range snapshots {
+		if i >= maxUndoSnapshots || time.Since(snapshot.Time) > cfg.maxAge() {
+			os.RemoveAll(snapshot.dir)
+			continue
+		}
+		keep[snapshot.dir] = struct{}{}
+	}
+	entries, _ := os.ReadDir(undoDir)
+	for _, entry := range entries {
+		dir := filepath.Join(undoDir, entry.Name())
+		info, err := entry.Info()
+		// A snapshot being taken has no manifest yet; give it time.
+		if _, ok := keep[dir]; !ok && err == nil && time.Since(info.ModTime()) > time.Hour {
+			os.RemoveAll(dir)
+		}
+	}
+}
+
+// Restore puts every path back as it was before the command ran, removing
+// the ones the command created, then deletes the snapshot.
+func (s *Snapshot) Restore() error {
+	var failed []string
+	for i := len(s.Entries) - 1; i >= 0; i-- {
+		entry := s.Entries[i]
+		if err := os.RemoveAll(entry.Path); err != nil {
+			failed = append(failed, entry.Path)
+			continue
+		}
+		if !entry.Existed {
+			continue
+		}
+		copier := &treeCopier{maxFiles: math.MaxInt, maxBytes: math.MaxInt64, preserve: true, owner: -1}
+		if err := copier.copy(filepath.Join(s.dir, entry.Backup), entry.Path); err != nil {
+			failed = append(failed, entry.Path)
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("failed to restore %s; the backup is kept in %s", strings.Join(failed, ", "), s.dir)
+	}
+	return os.RemoveAll(s.dir)
+}
+
+// affectedPaths returns the absolute paths result would change: existing
+// paths given to commands that modify files, destinations of copies and
+// moves, and redirect targets. Arguments that do not name a path, such as
+// sed scripts, are skipped because no such file exists.
+func affectedPaths(result Result, cwd string) []string {
+	modifies := result.Risk == RiskModifiesFiles || result.Risk == RiskDestructive
+	seen := make(map[string]struct{})
+	var paths []string
+	add := func(path string, mayNotExist bool) {
+		path = resolvePath(path, cwd)
+		if path == "" {
+			return
+		}
+		if _, ok := seen[path]; ok {
+			return
+		}
+		if _, err := os.Lstat(path); err != nil && !mayNotExist {
+			return
+		}
+		seen[path] = struct{}{}
+		paths = append(paths, path)
+	}
+
+	for _, stage := range result.Stages() {
+		command, args := unwrapCommand(stage.Cmd, stage.Args)
+		name := filepath.Base(command)
+		hasDestination, mutating := mutatingCommands[name]
+		_, createsFiles := newFileCommands[name]
+		switch name {
+		case "sed", "perl":
+			mutating = editsInPlace(args)
+		case "find":
+			mutating = hasAnyArg(args, nil, []string{"-delete", "-exec", "-execdir", "-ok"})
+		}
+		if mutating || createsFiles || modifies {
+			var operands []string
+			for _, arg := range args {
+				if isFlagLike(arg) {
+					continue
+				}
+				if name == "dd" {
+					if _, value, ok := strings.Cut(arg, "of="); ok {
+						add(value, true)
+					}
+					continue
+				}
+				operands = append(operands, arg)
+			}
+			for i, operand := range operands {
+				last := i == len(operands)-1 && len(operands) > 1
+				for _, path := range expandOperand(command, operand) {
+					add(path, createsFiles || hasDestination && last)
+				}
+			}
+		}
+		for _, redirect := range stage.Redirects {
+			if strings.Contains(redirect.Op, ">") && redirect.Target != "" &&
+				!strings.HasPrefix(redirect.Target, "&") && redirect.Target != "/dev/null" {
+				add(redirect.Target, true)
+			}
+		}
+	}
+	return dropNestedPaths(paths)
+}
+
+// editsInPlace reports whether sed or perl is given -i, alone, with a
+// backup suffix or in a bundle like perl's -pi.
+func editsInPlace(args []string) bool {
+	for _, arg := range args {
+		if strings.HasPrefix(arg, "-i") || strings.HasPrefix(arg, "--in-place") {
+			return true
+		}
+		if isShortBundle(arg) && strings.ContainsRune(arg[1:], 'i') {
+			return true
+		}
+	}
+	return false
+}
+
+// expandOperand expands a leading ~ and the wildcards meant for the shell.
+// Operands with variables or substitutions cannot be known in advance.
+func expandOperand(command, operand string) []string {
+	if strings.ContainsAny(operand, "$`") || strings.Contains(operand, "{{") {
+		return nil
+	}
+	if operand == "~" || strings.HasPrefix(operand, "~/") {
+		if home, err := os.UserHomeDir(); err == nil {
+			operand = home + operand[1:]
+		}
+	}
+	if shellGlobIntended(command, "", operand) {
+		matches, _ := filepath.Glob(operand)
+		return matches
+	}
+	return []string{operand}
+}
+
+func resolvePath(path, cwd string) string {
+	if path == "" || path == "-" {
+		return ""
+	}
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(cwd, path)
+	}
+	return filepath.Clean(path)
+}
+
+// dropNestedPaths removes paths inside other paths of the list, which are
+// backed up with them.
+func dropNestedPaths(paths []string) []string {
+	var kept []string
+	for _, path := range paths {
+		nested := false
+		for _, other := range paths {
+			if other != path && strings.HasPrefix(path, other+string(filepath.Separator)) {
+				nested = true
+				break
+			}
+		}
+		if !nested {
+			kept = append(kept, path)
+		}
+	}
+	return kept
+}
+
+// LatestSnapshot returns the most recent snapshot.
+func LatestSnapshot(cfg UndoConfig) (*Snapshot, error) {
+	snapshots, err := ListSnapshots(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if len(snapshots) == 0 {
+		return nil, errNoSnapshot
+	}
+	return snapshots[0], nil
+}
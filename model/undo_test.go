@@ -0,0 +1,185 @@
+package model
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestAffectedPaths(t *testing.T) {
+	cwd := t.TempDir()
+	for _, name := range []string{"a.txt", "b.txt", "build/out.o", "notes.md"} {
+		path := filepath.Join(cwd, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	in := func(names ...string) []string {
+		var paths []string
+		for _, name := range names {
+			paths = append(paths, filepath.Join(cwd, name))
+		}
+		return paths
+	}
+
+	tests := []struct {
+		name   string
+		result Result
+		want   []string
+	}{
+		{"read only", Result{Cmd: "cat", Args: []string{"a.txt"}}, nil},
+		{"rm", Result{Cmd: "rm", Args: []string{"-f", "a.txt", "missing.txt"}}, in("a.txt")},
+		{"rm nested", Result{Cmd: "rm", Args: []string{"-r", "build/out.o", "build"}}, in("build")},
+		{"mv to new name", Result{Cmd: "mv", Args: []string{"a.txt", "c.txt"}}, in("a.txt", "c.txt")},
+		{"glob", Result{Cmd: "rm", Args: []string{"*.txt"}}, in("a.txt", "b.txt")},
+		{"sed in place", Result{Cmd: "sed", Args: []string{"-i.bak", "s/a/b/", "notes.md"}}, in("notes.md")},
+		{"sed to stdout", Result{Cmd: "sed", Args: []string{"s/a/b/", "notes.md"}}, nil},
+		{"perl bundle", Result{Cmd: "perl", Args: []string{"-pi", "-e", "s/a/b/", "notes.md"}}, in("notes.md")},
+		{"redirect", Result{Cmd: "echo", Args: []string{"hi"}, Redirects: []Redirect{{Op: ">", Target: "new.txt"}, {Op: "2>", Target: "/dev/null"}}}, in("new.txt")},
+		{"touch", Result{Cmd: "touch", Args: []string{"new.txt"}}, in("new.txt")},
+		{"sudo", Result{Cmd: "sudo", Args: []string{"chmod", "600", "a.txt"}}, in("a.txt")},
+		{"dd", Result{Cmd: "dd", Args: []string{"if=a.txt", "of=copy.img"}}, in("copy.img")},
+		{"find delete", Result{Cmd: "find", Args: []string{"build", "-name", "*.o", "-delete"}}, in("build")},
+		{"variable", Result{Cmd: "rm", Args: []string{"$TARGET"}}, nil},
+		{"model says modifies", Result{Cmd: "mytool", Args: []string{"b.txt"}, Risk: RiskModifiesFiles}, in("b.txt")},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Chdir(cwd)
+			if got := affectedPaths(test.result, cwd); !slices.Equal(got, test.want) {
+				t.Errorf("affectedPaths(%s) = %q, want %q", test.result.Render(DialectPOSIX), got, test.want)
+			}
+		})
+	}
+}
+
+func TestEditsInPlace(t *testing.T) {
+	tests := map[string]bool{
+		"-i": true, "-i.bak": true, "--in-place": true, "--in-place=.orig": true,
+		"-pi": true, "-ne": false, "-e": false, "-n": false, "s/i/j/": false,
+	}
+	for arg, want := range tests {
+		if got := editsInPlace([]string{arg, "file"}); got != want {
+			t.Errorf("editsInPlace(%q) = %v, want %v", arg, got, want)
+		}
+	}
+}
+
+func TestDropNestedPaths(t *testing.T) {
+	got := dropNestedPaths([]string{"/p/a/b", "/p/a", "/p/ab", "/p/c/d"})
+	want := []string{"/p/a", "/p/ab", "/p/c/d"}
+	if !slices.Equal(got, want) {
+		t.Errorf("dropNestedPaths = %q, want %q", got, want)
+	}
+}
+
+func TestSnapshotRestore(t *testing.T) {
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	t.Setenv("HOME", t.TempDir())
+	cwd := t.TempDir()
+	t.Chdir(cwd)
+
+	dir := filepath.Join(cwd, "site")
+	file := filepath.Join(dir, "index.html")
+	if err := os.Mkdir(dir, 0o750); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(file, []byte("<h1>hi</h1>"), 0o640); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("index.html", filepath.Join(dir, "home.html")); err != nil {
+		t.Fatal(err)
+	}
+	old := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	for _, path := range []string{file, dir} {
+		if err := os.Chtimes(path, old, old); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	result := Result{
+		Cmd: "rm", Args: []string{"-r", "site"},
+		Pipeline: []Stage{{Op: "&&", Cmd: "touch", Args: []string{"created.txt"}}},
+	}
+	snapshot, err := TakeSnapshot(UndoConfig{}, result, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(snapshot.Entries) != 2 || len(snapshot.Skipped) != 0 {
+		t.Fatalf("snapshot entries %+v, skipped %q; want site and created.txt", snapshot.Entries, snapshot.Skipped)
+	}
+
+	// Run the command.
+	if err := os.RemoveAll(dir); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(cwd, "created.txt"), nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	latest, err := LatestSnapshot(UndoConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := latest.Restore(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Lstat(filepath.Join(cwd, "created.txt")); !os.IsNotExist(err) {
+		t.Error("the file the command created is still there")
+	}
+	data, err := os.ReadFile(file)
+	if err != nil || string(data) != "<h1>hi</h1>" {
+		t.Errorf("restored file = %q, %v", data, err)
+	}
+	if link, err := os.Readlink(filepath.Join(dir, "home.html")); err != nil || link != "index.html" {
+		t.Errorf("restored symlink = %q, %v", link, err)
+	}
+	for path, mode := range map[string]os.FileMode{dir: 0o750, file: 0o640} {
+		info, err := os.Stat(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Mode().Perm() != mode {
+			t.Errorf("%s mode = %v, want %v", path, info.Mode().Perm(), mode)
+		}
+		if !info.ModTime().Equal(old) {
+			t.Errorf("%s modified %v, want %v", path, info.ModTime(), old)
+		}
+	}
+	if _, err := LatestSnapshot(UndoConfig{}); err != errNoSnapshot {
+		t.Errorf("the snapshot is kept after restoring: %v", err)
+	}
+}
+
+func TestSnapshotSkipsUnrestorablePaths(t *testing.T) {
+	if os.Geteuid() == 0 {
+		t.Skip("root can restore every path")
+	}
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	cwd := t.TempDir()
+	locked := filepath.Join(cwd, "locked")
+	if err := os.Mkdir(locked, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(locked, "file"), nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chmod(locked, 0o555); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chmod(locked, 0o755) })
+	t.Chdir(cwd)
+
+	snapshot, err := TakeSnapshot(UndoConfig{}, Result{Cmd: "sudo", Args: []string{"rm", "locked/file"}}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(snapshot.Entries) != 0 || !slices.Equal(snapshot.Skipped, []string{filepath.Join(locked, "file")}) {
+		t.Errorf("snapshot entries %+v, skipped %q; want locked/file skipped", snapshot.Entries, snapshot.Skipped)
+	}
+}
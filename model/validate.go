@@ -0,0 +1,291 @@
+package model
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const validationTimeout = 10 * time.Second
+
+// ValidationConfig controls the checks run on generated commands.
+type ValidationConfig struct {
+	Disabled     bool `yaml:"disabled,omitempty"`
+	NoRegenerate bool `yaml:"no_regenerate,omitempty"`
+}
+
+// wrapperCommands run the command given as their first argument.
+var wrapperCommands = map[string]struct{}{
+	"sudo": {}, "doas": {}, "nice": {}, "nohup": {}, "time": {}, "timeout": {},
+	"env": {}, "command": {}, "exec": {}, "stdbuf": {}, "ionice": {}, "xargs": {},
+}
+
+// wrapperValueFlags are wrapper options followed by a value, as in
+// sudo -u postgres or nice -n 10.
+var wrapperValueFlags = map[string]struct{}{
+	"-u": {}, "-g": {}, "-C": {}, "-D": {}, "-h": {}, "-p": {}, "-r": {},
+	"-t": {}, "-U": {}, "-n": {}, "-c": {}, "-s": {}, "-k": {}, "-o": {}, "-e": {},
+}
+
+// xargsValueFlags are the options of xargs followed by a value, as in
+// xargs -I {} or xargs -P 4. Some of them take no value for sudo.
+var xargsValueFlags = map[string]struct{}{
+	"-I": {}, "-L": {}, "-P": {}, "-d": {}, "-E": {}, "-a": {}, "-n": {}, "-s": {},
+}
+
+// wrappedCommand returns the index in wrapper's arguments of the command
+// it runs, as rm in sudo -u root rm -rf x, or -1 if there is none.
+// Options, VAR=value and durations like timeout's 5s come before it;
+// empty arguments are skipped.
+func wrappedCommand(wrapper string, args []string) int {
+	valueFlags := wrapperValueFlags
+	if filepath.Base(wrapper) == "xargs" {
+		valueFlags = xargsValueFlags
+	}
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if arg == "" {
+			continue
+		}
+		if _, ok := valueFlags[arg]; ok {
+			i++
+			continue
+		}
+		if strings.HasPrefix(arg, "-") || strings.Contains(arg, "=") || arg[0] >= '0' && arg[0] <= '9' {
+			continue
+		}
+		return i
+	}
+	return -1
+}
+
+// Validator checks suggestions against what is installed. Known flags are
+// cached per command, since several suggestions often share one.
+type Validator struct {
+	index *ManIndex
+	shell string
+	flags map[string]map[string]struct{}
+}
+
+// NewValidator creates a validator that reads options from man pages,
+// bash's help and the catalog entries in index, which may be nil.
+func NewValidator(index *ManIndex) *Validator {
+	return &Validator{
+		index: index,
+		shell: UserShell(),
+		flags: make(map[string]map[string]struct{}),
+	}
+}
+
+// notInstalledProblem is the problem reported for a command that cannot
+// be found.
+func notInstalledProblem(command string) string {
+	return fmt.Sprintf("%s is not installed or not on PATH", command)
+}
+
+// Validate returns the problems found in result: programs that are not
+// installed, options their documentation does not list, and a command
+// line the shell cannot parse.
+func (v *Validator) Validate(ctx context.Context, result Result) []string {
+	var problems []string
+	for _, stage := range result.Stages() {
+		problems = append(problems, v.validateStage(ctx, stage.Cmd, stage.Args)...)
+	}
+	if err := v.checkSyntax(ctx, result.CommandLine()); err != nil {
+		problems = append(problems, err.Error())
+	}
+	return problems
+}
+
+func (v *Validator) validateStage(ctx context.Context, command string, args []string) []string {
+	if command == "" {
+		return []string{"empty command"}
+	}
+	if strings.Contains(command, "{{") {
+		return nil
+	}
+	if !isShellBuiltin(command) {
+		if _, err := exec.LookPath(command); err != nil {
+			return []string{notInstalledProblem(command)}
+		}
+	}
+	if _, ok := wrapperCommands[command]; ok {
+		if i := wrappedCommand(command, args); i >= 0 {
+			return v.validateStage(ctx, args[i], args[i+1:])
+		}
+		return nil
+	}
+
+	known := v.knownFlags(ctx, command)
+	name := command
+	var problems []string
+	for i, arg := range args {
+		if arg == "--" {
+			break
+		}
+		if !isFlagLike(arg) {
+			// git commit, docker run: the options that follow belong
+			// to the subcommand, which has its own page if any.
+			if i == 0 || !strings.HasPrefix(args[i-1], "-") {
+				if sub := v.knownFlags(ctx, command+"-"+arg); sub != nil {
+					known = sub
+					name = command + " " + arg
+				} else if v.hasSubcommands(ctx, command) {
+					known = nil
+				}
+			}
+			continue
+		}
+		if known == nil {
+			continue
+		}
+		if !flagKnown(known, arg) {
+			problems = append(problems, fmt.Sprintf("%s has no option %s", name, flagName(arg)))
+		}
+	}
+	return problems
+}
+
+// knownFlags returns the option names documented for command, or nil when
+// there is no documentation with enough options to judge by. Suggested
+// programs are never run to find out: --help is not safe for programs
+// nobody has vetted, and validation happens before the user sees them.
+func (v *Validator) knownFlags(ctx context.Context, command string) map[string]struct{} {
+	if flags, ok := v.flags[command]; ok {
+		return flags
+	}
+	var text string
+	var err error
+	doc, indexed := v.index.Lookup(command)
+	switch {
+	case isShellBuiltin(command):
+		text, err = fetchBuiltinHelp(ctx, command)
+	case indexed && doc.CatalogPath != "":
+		var entry CatalogEntry
+		if entry, err = readCatalogEntry(doc.CatalogPath, doc.Name); err == nil {
+			text = entry.ManText()
+		}
+	default:
+		text, err = fetchManText(ctx, command)
+	}
+	var flags map[string]struct{}
+	if err == nil {
+		parsed := parseManFlags(text)
+		if len(parsed) >= minUsefulFlags {
+			flags = make(map[string]struct{})
+			for _, flag := range parsed {
+				for _, name := range flag.Names() {
+					flags[name] = struct{}{}
+				}
+			}
+		}
+	}
+	v.flags[command] = flags
+	return flags
+}
+
+// hasSubcommands reports whether command's synopsis takes a subcommand,
+// like git <command> or docker COMMAND.
+func (v *Validator) hasSubcommands(ctx context.Context, command string) bool {
+	text, err := fetchManText(ctx, command)
+	if err != nil {
+		return false
+	}
+	synopsis := strings.ToLower(splitManSections(text)["SYNOPSIS"])
+	return strings.Contains(synopsis, "command")
+}
+
+func (v *Validator) checkSyntax(ctx context.Context, line string) error {
+	shell := v.shell
+	if _, err := exec.LookPath(shell); err != nil {
+		return nil
+	}
+	output, err := runSandboxed(ctx, shell, "-n", "-c", line)
+	if err == nil {
+		return nil
+	}
+	if output = strings.TrimSpace(output); output != "" {
+		return fmt.Errorf("shell syntax error: %s", firstLine(output))
+	}
+	return fmt.Errorf("shell syntax error")
+}
+
+func firstLine(text string) string {
+	line, _, _ := strings.Cut(text, "\n")
+	return line
+}
+
+// isFlagLike accepts -x, -xyz and --long, but not "-", negative numbers
+// such as find's -mtime -7, or placeholders.
+func isFlagLike(arg string) bool {
+	if len(arg) < 2 || arg[0] != '-' || strings.Contains(arg, "{{") {
+		return false
+	}
+	if arg[1] >= '0' && arg[1] <= '9' || arg[1] == '.' {
+		return false
+	}
+	return true
+}
+
+func flagName(arg string) string {
+	if name, _, ok := strings.Cut(arg, "="); ok {
+		return name
+	}
+	return arg
+}
+
+// flagKnown matches arg against the documented names, allowing GNU's
+// abbreviated long options, bundled short options like -la, and values
+// attached to a short option like -n5.
+func flagKnown(known map[string]struct{}, arg string) bool {
+	name := flagName(arg)
+	if _, ok := known[name]; ok {
+		return true
+	}
+	if strings.HasPrefix(name, "--") {
+		for option := range known {
+			if strings.HasPrefix(option, name) && len(name) > 3 {
+				return true
+			}
+		}
+		return false
+	}
+	// A bundle like -la or a value attached like -n5 or -uroot.
+	_, ok := known[name[:2]]
+	return ok
+}
+
+// validateResults annotates each result with its problems and moves the
+// ones without problems to the front, keeping the model's order otherwise.
+func validateResults(ctx context.Context, validator *Validator, results []Result) []Result {
+	for i := range results {
+		results[i].Warnings = validator.Validate(ctx, results[i])
+	}
+	sort.SliceStable(results, func(i, j int) bool {
+		return len(results[i].Warnings) == 0 && len(results[j].Warnings) > 0
+	})
+	return results
+}
+
+// validationFeedback lists the problems of results for the retry prompt.
+func validationFeedback(results []Result) []string {
+	var feedback []string
+	for _, result := range results {
+		for _, warning := range result.Warnings {
+			feedback = append(feedback, fmt.Sprintf("%s: %s", result.CommandLine(), warning))
+		}
+	}
+	return feedback
+}
+
+func countWarnings(results []Result) int {
+	count := 0
+	for _, result := range results {
+		count += len(result.Warnings)
+	}
+	return count
+}
@@ -0,0 +1,35 @@
+package model
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestValidateDoesNotRunUnknownCommands(t *testing.T) {
+	dir := t.TempDir()
+	marker := filepath.Join(dir, "ran")
+	script := filepath.Join(dir, "deploy-release")
+	if err := os.WriteFile(script, []byte("#!/bin/sh\ntouch "+marker+"\n"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "git-ship"), []byte("#!/bin/sh\ntouch "+marker+"\n"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	validator := NewValidator(nil)
+	for _, result := range []Result{
+		{Cmd: "deploy-release", Args: []string{"--everything", "-f"}},
+		{Cmd: script, Args: []string{"--now"}},
+		{Cmd: "git", Args: []string{"ship", "--force"}},
+	} {
+		if problems := validator.Validate(context.Background(), result); len(problems) > 0 {
+			t.Errorf("Validate(%s) = %q, want no problems without documentation", result.Render(DialectPOSIX), problems)
+		}
+	}
+	if _, err := os.Stat(marker); err == nil {
+		t.Error("validation ran a suggested program")
+	}
+}
@@ -0,0 +1,349 @@
+package model
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	defaultWorkspaceEntries    = 40
+	maxWorkspaceCharacters     = 1200
+	maxWorkspaceTasksPerRunner = 15
+)
+
+// WorkspaceConfig enables the working-directory context provider.
+type WorkspaceConfig struct {
+	Enabled    bool `yaml:"enabled"`
+	MaxEntries int  `yaml:"max_entries,omitempty"`
+}
+
+// WorkspaceProvider describes the files in the working directory and the
+// project type and task runners found there.
+type WorkspaceProvider struct {
+	config WorkspaceConfig
+	dir    string
+}
+
+func (wp WorkspaceProvider) Name() string {
+	return "Current directory"
+}
+
+func (wp WorkspaceProvider) Collect(userInput string, keywords []string) string {
+	dir := wp.dir
+	if dir == "" {
+		cwd, err := os.Getwd()
+		if err != nil {
+			return ""
+		}
+		dir = cwd
+	}
+	maxEntries := wp.config.MaxEntries
+	if maxEntries <= 0 {
+		maxEntries = defaultWorkspaceEntries
+	}
+
+	// Project facts are usually what the question is about, so they get
+	// the budget first and the listing is cut to whatever remains.
+	project := strings.Join(detectProject(dir), "\n")
+	budget := maxWorkspaceCharacters - len(project)
+	listing := listWorkspace(dir, maxEntries, budget)
+
+	var parts []string
+	if listing != "" {
+		parts = append(parts, listing)
+	}
+	if project != "" {
+		parts = append(parts, project)
+	}
+	return strings.Join(parts, "\n")
+}
+
+func listWorkspace(dir string, maxEntries, budget int) string {
+	entries, err := os.ReadDir(dir)
+	if err != nil || budget <= 0 {
+		return ""
+	}
+	ignore := loadGitignore(filepath.Join(dir, ".gitignore"))
+
+	var lines []string
+	shown, skipped, size := 0, 0, 0
+	for _, entry := range entries {
+		name := entry.Name()
+		if name == ".git" || ignore.matches(name, entry.IsDir()) {
+			continue
+		}
+		if shown >= maxEntries {
+			skipped++
+			continue
+		}
+		line := "  " + describeEntry(dir, entry)
+		if size+len(line)+1 > budget {
+			skipped++
+			continue
+		}
+		lines = append(lines, line)
+		size += len(line) + 1
+		shown++
+	}
+	if len(lines) == 0 {
+		return ""
+	}
+	header := fmt.Sprintf("Files (%d shown", shown)
+	if skipped > 0 {
+		header += fmt.Sprintf(", %d more", skipped)
+	}
+	header += "):"
+	return header + "\n" + strings.Join(lines, "\n")
+}
+
+func describeEntry(dir string, entry os.DirEntry) string {
+	name := entry.Name()
+	switch {
+	case entry.IsDir():
+		return name + "/"
+	case entry.Type()&os.ModeSymlink != 0:
+		if target, err := os.Readlink(filepath.Join(dir, name)); err == nil {
+			return fmt.Sprintf("%s -> %s", name, target)
+		}
+		return name + "@"
+	}
+	info, err := entry.Info()
+	if err != nil {
+		return name
+	}
+	return fmt.Sprintf("%s (%s)", name, humanSize(info.Size()))
+}
+
+func humanSize(size int64) string {
+	const unit = 1024
+	if size < unit {
+		return fmt.Sprintf("%d B", size)
+	}
+	div, exp := int64(unit), 0
+	for n := size / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %cB", float64(size)/float64(div), "KMGTPE"[exp])
+}
+
+type gitignore struct {
+	patterns []gitignorePattern
+}
+
+type gitignorePattern struct {
+	glob    string
+	dirOnly bool
+	negate  bool
+}
+
+// loadGitignore reads the top-level patterns of a .gitignore. Only names in
+// the listed directory are matched, so patterns with inner slashes are skipped.
+func loadGitignore(path string) gitignore {
+	var ignore gitignore
+	file, err := os.Open(path)
+	if err != nil {
+		return ignore
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		pattern := gitignorePattern{}
+		if strings.HasPrefix(line, "!") {
+			pattern.negate = true
+			line = line[1:]
+		}
+		if strings.HasSuffix(line, "/") {
+			pattern.dirOnly = true
+			line = strings.TrimSuffix(line, "/")
+		}
+		line = strings.TrimPrefix(line, "/")
+		line = strings.TrimPrefix(line, "**/")
+		if line == "" || strings.Contains(line, "/") {
+			continue
+		}
+		pattern.glob = line
+		ignore.patterns = append(ignore.patterns, pattern)
+	}
+	return ignore
+}
+
+func (g gitignore) matches(name string, isDir bool) bool {
+	ignored := false
+	for _, pattern := range g.patterns {
+		if pattern.dirOnly && !isDir {
+			continue
+		}
+		if ok, _ := filepath.Match(pattern.glob, name); ok {
+			ignored = !pattern.negate
+		}
+	}
+	return ignored
+}
+
+var (
+	makeTargetPattern = regexp.MustCompile(`^([A-Za-z0-9][A-Za-z0-9_./-]*)\s*:([^=]|$)`)
+	justRecipePattern = regexp.MustCompile(`^@?([A-Za-z0-9_-]+)(\s[^:]*)?:([^=]|$)`)
+)
+
+// detectProject reports the project types and task runner entries in dir.
+func detectProject(dir string) []string {
+	var facts []string
+
+	if name := firstExisting(dir, "go.mod"); name != "" {
+		module := ""
+		if line := firstLineWithPrefix(filepath.Join(dir, name), "module "); line != "" {
+			module = " " + strings.TrimSpace(strings.TrimPrefix(line, "module "))
+		}
+		facts = append(facts, fmt.Sprintf("Project: Go module%s (go build ./..., go test ./...)", module))
+	}
+	if name := firstExisting(dir, "Cargo.toml"); name != "" {
+		facts = append(facts, "Project: Rust crate (cargo build, cargo test, cargo run)")
+	}
+	if name := firstExisting(dir, "pyproject.toml", "setup.py", "requirements.txt"); name != "" {
+		facts = append(facts, fmt.Sprintf("Project: Python (%s)", name))
+	}
+	if name := firstExisting(dir, "package.json"); name != "" {
+		runner := "npm"
+		switch {
+		case firstExisting(dir, "pnpm-lock.yaml") != "":
+			runner = "pnpm"
+		case firstExisting(dir, "yarn.lock") != "":
+			runner = "yarn"
+		case firstExisting(dir, "bun.lockb", "bun.lock") != "":
+			runner = "bun"
+		}
+		scripts := packageScripts(filepath.Join(dir, name))
+		if len(scripts) > 0 {
+			facts = append(facts, fmt.Sprintf("%s scripts (%s run <name>): %s", runner, runner, joinLimited(scripts)))
+		} else {
+			facts = append(facts, fmt.Sprintf("Project: Node.js (%s)", runner))
+		}
+	}
+	if name := firstExisting(dir, "GNUmakefile", "Makefile", "makefile"); name != "" {
+		targets := matchLines(filepath.Join(dir, name), makeTargetPattern)
+		facts = append(facts, fmt.Sprintf("Make targets (make <target>): %s", joinLimited(targets)))
+	}
+	if name := firstExisting(dir, "justfile", "Justfile", ".justfile"); name != "" {
+		recipes := matchLines(filepath.Join(dir, name), justRecipePattern)
+		facts = append(facts, fmt.Sprintf("just recipes (just <recipe>): %s", joinLimited(recipes)))
+	}
+	if name := firstExisting(dir, "compose.yaml", "compose.yml", "docker-compose.yml", "docker-compose.yaml"); name != "" {
+		services := composeServices(filepath.Join(dir, name))
+		facts = append(facts, fmt.Sprintf("Compose services in %s (docker compose up <service>): %s", name, joinLimited(services)))
+	}
+	if name := firstExisting(dir, "Dockerfile"); name != "" {
+		facts = append(facts, "Dockerfile present")
+	}
+
+	return facts
+}
+
+func firstExisting(dir string, names ...string) string {
+	for _, name := range names {
+		if _, err := os.Stat(filepath.Join(dir, name)); err == nil {
+			return name
+		}
+	}
+	return ""
+}
+
+func firstLineWithPrefix(path, prefix string) string {
+	file, err := os.Open(path)
+	if err != nil {
+		return ""
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		if line := scanner.Text(); strings.HasPrefix(line, prefix) {
+			return line
+		}
+	}
+	return ""
+}
+
+func matchLines(path string, pattern *regexp.Regexp) []string {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil
+	}
+	defer file.Close()
+
+	seen := make(map[string]struct{})
+	var names []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		match := pattern.FindStringSubmatch(scanner.Text())
+		if match == nil || strings.HasPrefix(match[1], ".") {
+			continue
+		}
+		if _, ok := seen[match[1]]; ok {
+			continue
+		}
+		seen[match[1]] = struct{}{}
+		names = append(names, match[1])
+	}
+	return names
+}
+
+func packageScripts(path string) []string {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+	var pkg struct {
+		Scripts map[string]string `json:"scripts"`
+	}
+	if err := json.Unmarshal(data, &pkg); err != nil {
+		return nil
+	}
+	var names []string
+	for name := range pkg.Scripts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func composeServices(path string) []string {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+	var compose struct {
+		Services map[string]yaml.Node `yaml:"services"`
+	}
+	if err := yaml.Unmarshal(data, &compose); err != nil {
+		return nil
+	}
+	var names []string
+	for name := range compose.Services {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func joinLimited(names []string) string {
+	if len(names) == 0 {
+		return "(none found)"
+	}
+	if len(names) > maxWorkspaceTasksPerRunner {
+		return fmt.Sprintf("%s, ... (%d more)", strings.Join(names[:maxWorkspaceTasksPerRunner], ", "), len(names)-maxWorkspaceTasksPerRunner)
+	}
+	return strings.Join(names, ", ")
+}